@@ -0,0 +1,371 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+	"github.com/google/uuid"
+)
+
+const (
+	// custom analyzers run on the assistant of the optimization goal with their own instructions
+	customAssistantId         = "asst_9zcQxyRh4E10Agg08p8mYDO8"
+	maxAnalyzerLabelLength    = 40
+	maxAnalyzerInstructLength = 2000
+	maxAnalyzersPerOwner      = 20
+)
+
+// formList accepts a list or a single string, as forms send a single checked checkbox as a string
+type formList []string
+
+func (l *formList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*l = list
+		return nil
+	}
+
+	var single string
+	if err := json.Unmarshal(data, &single); err != nil {
+		return err
+	}
+
+	if single == "" {
+		*l = nil
+	} else {
+		*l = []string{single}
+	}
+
+	return nil
+}
+
+type customAnalyzerReq struct {
+	Label        string `json:"label"`
+	Instructions string `json:"instructions"`
+}
+
+var nonWordChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// analyzerName derives the snake case type of a custom analyzer's runs and suggestions
+func analyzerName(label string) string {
+	return strings.Trim(nonWordChars.ReplaceAllString(strings.ToLower(label), "_"), "_")
+}
+
+// reservedName tells if a name is used by built-in runs
+func reservedName(name string) bool {
+	if name == lintAnalyzer || name == "operator" {
+		return true
+	}
+
+	_, ok := findAnalyzer(name)
+	return ok
+}
+
+func (r customAnalyzerReq) analyzer(owner string, existing []domain.CustomAnalyzer) (*domain.CustomAnalyzer, error) {
+	label := strings.TrimSpace(r.Label)
+	instructions := strings.TrimSpace(r.Instructions)
+	name := analyzerName(label)
+
+	if name == "" {
+		return nil, errors.New("the name has to contain letters or digits")
+	} else if utf8.RuneCountInString(label) > maxAnalyzerLabelLength {
+		return nil, fmt.Errorf("the name can't be longer than %d characters", maxAnalyzerLabelLength)
+	} else if instructions == "" {
+		return nil, errors.New("the evaluation instructions are missing")
+	} else if utf8.RuneCountInString(instructions) > maxAnalyzerInstructLength {
+		return nil, fmt.Errorf("the evaluation instructions can't be longer than %d characters", maxAnalyzerInstructLength)
+	} else if reservedName(name) {
+		return nil, fmt.Errorf("%s is a built-in dimension", label)
+	} else if len(existing) >= maxAnalyzersPerOwner {
+		return nil, fmt.Errorf("you can't define more than %d analyzers", maxAnalyzersPerOwner)
+	}
+
+	for i := 0; i < len(existing); i++ {
+		if existing[i].Name == name {
+			return nil, fmt.Errorf("an analyzer named %s already exists", existing[i].Label)
+		}
+	}
+
+	return &domain.CustomAnalyzer{
+		Id:           uuid.New().String(),
+		Name:         name,
+		Label:        label,
+		Instructions: instructions,
+		Owner:        owner}, nil
+}
+
+func ownsAnalyzer(analyzer domain.CustomAnalyzer, sessionId string) bool {
+	return analyzer.Owner != "" && analyzer.Owner == sessionId
+}
+
+type AnalyzerView struct {
+	Analyzers []domain.CustomAnalyzer
+	Form      domain.CustomAnalyzer
+	ErrMsg    string
+}
+
+func readSessionAnalyzers(ctx context.Context, repo *Repo, sessionId string) ([]domain.CustomAnalyzer, error) {
+	if sessionId == "" {
+		return []domain.CustomAnalyzer{}, nil
+	}
+
+	analyzers, err := repo.AnalyzerRepo.ReadMany(ctx, AnalyzerReadFilter{OwnerCond: fmt.Sprintf("eq.%s", sessionId)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return *analyzers, nil
+}
+
+// readCustomAnalyzers reads the analyzers with the given ids. Analyzers deleted in the meantime
+// are skipped.
+func readCustomAnalyzers(ctx context.Context, repo *Repo, ids []string) ([]domain.CustomAnalyzer, error) {
+	if len(ids) == 0 {
+		return []domain.CustomAnalyzer{}, nil
+	}
+
+	analyzers, err := repo.AnalyzerRepo.ReadMany(ctx, AnalyzerReadFilter{IdCond: inCond(ids)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return *analyzers, nil
+}
+
+// readOwnedAnalyzers reads the selected analyzers and fails if the session doesn't own one of them
+func readOwnedAnalyzers(ctx context.Context, repo *Repo, ids []string, sessionId string) ([]domain.CustomAnalyzer, error) {
+	analyzers, err := readCustomAnalyzers(ctx, repo, ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(analyzers) != len(ids) {
+		return nil, errors.New("unknown analyzer selected")
+	}
+
+	for i := 0; i < len(analyzers); i++ {
+		if !ownsAnalyzer(analyzers[i], sessionId) {
+			return nil, errors.New("analyzer not owned by session")
+		}
+	}
+
+	return analyzers, nil
+}
+
+func readOpAnalyzers(ctx context.Context, repo *Repo, opId string) ([]domain.CustomAnalyzer, error) {
+	op, err := repo.OpRepo.Read(ctx, opId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readCustomAnalyzers(ctx, repo, op.Analyzers)
+}
+
+func customAssistants(custom []domain.CustomAnalyzer) []assistant {
+	assistants := make([]assistant, len(custom))
+
+	for i := 0; i < len(custom); i++ {
+		assistants[i] = assistant{Id: customAssistantId, Name: custom[i].Name, Instructions: custom[i].Instructions}
+	}
+
+	return assistants
+}
+
+func analyzerLabels(custom []domain.CustomAnalyzer) map[string]string {
+	labels := make(map[string]string, len(custom))
+
+	for i := 0; i < len(custom); i++ {
+		labels[custom[i].Name] = custom[i].Label
+	}
+
+	return labels
+}
+
+func analyzerNames(custom []domain.CustomAnalyzer) []string {
+	names := make([]string, len(custom))
+
+	for i := 0; i < len(custom); i++ {
+		names[i] = custom[i].Name
+	}
+
+	return names
+}
+
+func analyzerIds(custom []domain.CustomAnalyzer) []string {
+	ids := make([]string, len(custom))
+
+	for i := 0; i < len(custom); i++ {
+		ids[i] = custom[i].Id
+	}
+
+	return ids
+}
+
+// AnalyzerProgress tells if the run of a custom analyzer completed
+type AnalyzerProgress struct {
+	Name      string
+	Label     string
+	Completed bool
+}
+
+func analyzerProgress(custom []domain.CustomAnalyzer) []AnalyzerProgress {
+	progress := make([]AnalyzerProgress, len(custom))
+
+	for i := 0; i < len(custom); i++ {
+		progress[i] = AnalyzerProgress{Name: custom[i].Name, Label: custom[i].Label}
+	}
+
+	sort.SliceStable(progress, func(i, j int) bool {
+		return progress[i].Label < progress[j].Label
+	})
+
+	return progress
+}
+
+type AnalyzerController struct {
+	ComponentBuilder *ComponentBuilder
+	Repo             *Repo
+	Config           *Config
+}
+
+func (c AnalyzerController) list(ctx context.Context, sessionId string, view AnalyzerView, code int, err error) *AppResp {
+	analyzers, readErr := readSessionAnalyzers(ctx, c.Repo, sessionId)
+
+	if readErr != nil {
+		errConfig500 := get500()
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+			Code:        errConfig500.Code,
+			Message:     errConfig500.Msg,
+			ContentType: "text/html",
+			Error:       readErr}
+	}
+
+	view.Analyzers = analyzers
+
+	return &AppResp{Component: c.ComponentBuilder.Analyzers(view),
+		Code: code, Message: http.StatusText(code), ContentType: "text/html", Error: err}
+}
+
+func (c AnalyzerController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
+	sessionId := readSession(w, r, c.Config)
+	errConfig400 := get400()
+	errConfig500 := get500()
+
+	switch r.Method {
+	case "GET":
+		return c.list(ctx, sessionId, AnalyzerView{}, 200, nil)
+	case "POST":
+		body, err := Read(r.Body)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code:        errConfig400.Code,
+				Message:     errConfig400.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		req, err := ReadJSON[customAnalyzerReq](body)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code:        errConfig400.Code,
+				Message:     errConfig400.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		existing, err := readSessionAnalyzers(ctx, c.Repo, sessionId)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		analyzer, err := req.analyzer(sessionId, existing)
+
+		if err != nil {
+			return c.list(ctx, sessionId, AnalyzerView{Form: domain.CustomAnalyzer{Label: req.Label, Instructions: req.Instructions}, ErrMsg: err.Error()},
+				errConfig400.Code, err)
+		}
+
+		err = c.Repo.AnalyzerRepo.Insert(ctx, *analyzer)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		return c.list(ctx, sessionId, AnalyzerView{}, 201, nil)
+	case "DELETE":
+		id := r.URL.Query().Get("id")
+
+		if id == "" {
+			err := errors.New("missing id query parameter")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		analyzers, err := readCustomAnalyzers(ctx, c.Repo, []string{id})
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		if len(analyzers) == 0 {
+			errConfig404 := get404()
+			err = errors.New("analyzer not found")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig404.Code), errConfig404.Title, errConfig404.Msg),
+				Code: errConfig404.Code, Message: errConfig404.Msg, ContentType: "text/html", Error: err}
+		}
+
+		if !ownsAnalyzer(analyzers[0], sessionId) {
+			errConfig403 := get403()
+			err = errors.New("analyzer not owned by session")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+				Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+		}
+
+		// past suggestions and runs of the analyzer are kept, they're shown by their type afterwards
+		err = c.Repo.AnalyzerRepo.Delete(ctx, id)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		return c.list(ctx, sessionId, AnalyzerView{}, 200, nil)
+	default:
+		errConfig := get405()
+		err := errors.New("method not allowed")
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig.Code), errConfig.Title, errConfig.Msg),
+			Code: errConfig.Code, Message: errConfig.Msg, ContentType: "text/html", Error: err}
+	}
+}
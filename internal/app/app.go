@@ -1,87 +1,275 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/a-h/templ"
 	"github.com/felixbrock/prompt-grammarly/internal/domain"
+	"github.com/felixbrock/prompt-grammarly/internal/metrics"
 	"golang.org/x/time/rate"
 )
 
 type ComponentBuilder struct {
 	Index            func() templ.Component
 	App              func() templ.Component
-	Draft            func() templ.Component
-	Edit             func(id string, original string, optimized string, instructions string, suggestions *[]domain.Suggestion) templ.Component
-	SuggestionWindow func(suggs *[]domain.Suggestion) templ.Component
+	Profile          func(profile PreferenceProfile) templ.Component
+	History          func(entries []HistoryEntry, currentId string) templ.Component
+	ShareLink        func(link ShareLink) templ.Component
+	Shared           func(op *domain.Optimization, suggs *[]domain.Suggestion, labels map[string]string) templ.Component
+	Report           func(report Report, css string) templ.Component
+	Search           func(view SearchView) templ.Component
+	EvaluationForm   func(form EvaluationForm) templ.Component
+	Evaluation       func(view EvaluationView) templ.Component
+	AutoRunForm      func(form AutoRunForm) templ.Component
+	AutoRun          func(view AutoRunView) templ.Component
+	SearchResults    func(view SearchView) templ.Component
+	Library          func(view LibraryView) templ.Component
+	LibraryPrompt    func(detail LibraryDetail) templ.Component
+	LibraryForm      func(form LibraryForm) templ.Component
+	BatchUpload      func(errMsg string) templ.Component
+	BatchProgress    func(progress BatchProgress) templ.Component
+	Analyzers        func(view AnalyzerView) templ.Component
+	Draft            func(analyzers []domain.CustomAnalyzer, redacted bool) templ.Component
+	Edit             func(id string, original string, optimized string, instructions string, suggestions *[]domain.Suggestion, view SuggView, variables VariableCheck, tokens TokenView, scores Scorecard) templ.Component
+	SuggestionWindow func(suggs *[]domain.Suggestion, view SuggView) templ.Component
 	Loading          func(optimizationId string, state AnalysisState) templ.Component
 	Error            func(code string, title string, msg string) templ.Component
 }
 
 type Config struct {
-	Env       string `json:"Env"`
-	Port      string `json:"GO_PORT"`
-	DBApiKey  string `json:"DB_API_KEY"`
-	DBUrl     string `json:"DB_URL"`
-	OAIApiKey string `json:"OAI_API_KEY"`
-	PHApiKey  string `json:"PH_API_KEY"`
+	Env              string `json:"Env"`
+	Port             string `json:"GO_PORT"`
+	DBApiKey         string `json:"DB_API_KEY"`
+	DBUrl            string `json:"DB_URL"`
+	OAIApiKey        string `json:"OAI_API_KEY"`
+	PHApiKey         string `json:"PH_API_KEY"`
+	GoodShotLimit    int    `json:"GOOD_SHOT_LIMIT"`
+	WrongShotLimit   int    `json:"WRONG_SHOT_LIMIT"`
+	ShareTTLHours    int    `json:"SHARE_TTL_HOURS"`
+	BatchConcurrency int    `json:"BATCH_CONCURRENCY"`
+	// RetentionDays is the number of days optimizations are kept, 0 keeps them indefinitely
+	RetentionDays int `json:"RETENTION_DAYS"`
+	// EvalModel is preselected for evaluations, JudgeModel compares their outputs
+	EvalModel  string `json:"EVAL_MODEL"`
+	JudgeModel string `json:"JUDGE_MODEL"`
+	// LintDisabledRules is a comma separated list of lint rule ids that are skipped
+	LintDisabledRules string `json:"LINT_DISABLED_RULES"`
+	// TokenizerDir holds the tiktoken rank files TokenizerModel's encoding is read from
+	TokenizerDir   string `json:"TOKENIZER_DIR"`
+	TokenizerModel string `json:"TOKENIZER_MODEL"`
+	// RedactionKey is the base64 encoded AES-256 key the placeholder maps of redacted prompts are
+	// encrypted with. RedactionPatterns is a JSON array of additional regular expressions to redact.
+	// RedactionDisabled stores and sends prompts as entered, it has to be set if there is no key.
+	RedactionKey      string `json:"REDACTION_KEY"`
+	RedactionPatterns string `json:"REDACTION_PATTERNS"`
+	RedactionDisabled bool   `json:"REDACTION_DISABLED"`
+	// TracingExporter is either empty to disable tracing, "stdout" or "otlp". OTLPEndpoint is the
+	// base url of the collector spans are sent to.
+	TracingExporter string `json:"TRACING_EXPORTER"`
+	OTLPEndpoint    string `json:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	ServiceName     string `json:"OTEL_SERVICE_NAME"`
 }
 
 type OpUpdateOpts struct {
 	State           string `json:"state"`
 	OptimizedPrompt string `json:"optimized_prompt"`
 	ParentId        string `json:"parent_id"`
+	TokensUsed      int    `json:"tokens_used,omitempty"`
+}
+
+type OpReadFilter struct {
+	IdCond              string
+	ParentIdCond        string
+	SessionIdCond       string
+	BatchIdCond         string
+	LibraryPromptIdCond string
+	AutoRunIdCond       string
+	CreatedAtConds      []string
+	// SearchText is matched against the prompt, optimized prompt and instructions with full-text search
+	SearchText string
+	Limit      int
 }
 
 type opRepo interface {
-	Insert(optimization domain.Optimization) error
-	Update(id string, opts OpUpdateOpts) error
-	Read(id string) (*domain.Optimization, error)
+	Insert(ctx context.Context, optimization domain.Optimization) error
+	Update(ctx context.Context, id string, opts OpUpdateOpts) error
+	Read(ctx context.Context, id string) (*domain.Optimization, error)
+	ReadMany(ctx context.Context, filter OpReadFilter) (*[]domain.Optimization, error)
+	Link(ctx context.Context, id string, libraryPromptId string) error
+	Unlink(ctx context.Context, libraryPromptId string) error
+	Detach(ctx context.Context, parentIdCond string) error
+	Delete(ctx context.Context, idCond string) (int, error)
+}
+
+type LibUpdateOpts struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+type LibReadFilter struct {
+	IdCond    string
+	OwnerCond string
+	TagsCond  string
+}
+
+type AnalyzerReadFilter struct {
+	IdCond    string
+	OwnerCond string
+}
+
+type customAnalyzerRepo interface {
+	Insert(ctx context.Context, analyzer domain.CustomAnalyzer) error
+	Delete(ctx context.Context, id string) error
+	ReadMany(ctx context.Context, filter AnalyzerReadFilter) (*[]domain.CustomAnalyzer, error)
+}
+
+type libraryRepo interface {
+	Insert(ctx context.Context, prompt domain.LibraryPrompt) error
+	Update(ctx context.Context, id string, opts LibUpdateOpts) error
+	Delete(ctx context.Context, id string) error
+	Read(ctx context.Context, id string) (*domain.LibraryPrompt, error)
+	ReadMany(ctx context.Context, filter LibReadFilter) (*[]domain.LibraryPrompt, error)
 }
 
 type RunReadFilter struct {
 	OptimizationId string
 }
 
+type RunScoreOpts struct {
+	Score              *int16 `json:"score,omitempty"`
+	Rationale          string `json:"rationale,omitempty"`
+	OptimizedScore     *int16 `json:"optimized_score,omitempty"`
+	OptimizedRationale string `json:"optimized_rationale,omitempty"`
+}
+
 type runRepo interface {
-	Insert(run domain.Run) error
-	Update(id string, state string) error
-	Read(filter RunReadFilter) (*[]domain.Run, error)
+	Insert(ctx context.Context, run domain.Run) error
+	Update(ctx context.Context, id string, state string) error
+	UpdateScores(ctx context.Context, id string, opts RunScoreOpts) error
+	Read(ctx context.Context, filter RunReadFilter) (*[]domain.Run, error)
+	Delete(ctx context.Context, opIdCond string) (int, error)
 }
 
 type SuggReadFilter struct {
-	OpIdCond   string
-	UFeedbCond string
+	IdCond        string
+	OpIdCond      string
+	UFeedbCond    string
+	SeverityCond  string
+	AnalyzersCond string
+	// SessionIdCond is applied to the optimization a suggestion belongs to
+	SessionIdCond string
+	SearchText    string
+	Limit         int
 }
 
 type suggRepo interface {
-	Insert(suggestions []domain.Suggestion) error
-	Update(id string, userFeedback int16) error
-	Read(filter SuggReadFilter) (*[]domain.Suggestion, error)
+	Insert(ctx context.Context, suggestions []domain.Suggestion) error
+	Update(ctx context.Context, id string, userFeedback int16) error
+	Read(ctx context.Context, filter SuggReadFilter) (*[]domain.Suggestion, error)
+	Delete(ctx context.Context, opIdCond string) (int, error)
+}
+
+type FeedbReadFilter struct {
+	SuggIdCond    string
+	OpIdCond      string
+	SessionIdCond string
+	CreatedAtCond string
+	Limit         int
+}
+
+type feedbRepo interface {
+	Insert(ctx context.Context, event domain.FeedbackEvent) error
+	Read(ctx context.Context, filter FeedbReadFilter) (*[]domain.FeedbackEvent, error)
+	Delete(ctx context.Context, opIdCond string) (int, error)
+}
+
+type profileRepo interface {
+	Upsert(ctx context.Context, profile domain.Profile) error
+	Read(ctx context.Context, sessionId string) (*domain.Profile, error)
+}
+
+type batchRepo interface {
+	Insert(ctx context.Context, batch domain.Batch) error
+	Update(ctx context.Context, id string, state string) error
+	Read(ctx context.Context, id string) (*domain.Batch, error)
+}
+
+type shareRepo interface {
+	Insert(ctx context.Context, share domain.Share) error
+	Revoke(ctx context.Context, id string) error
+	Read(ctx context.Context, id string) (*domain.Share, error)
+	ReadByToken(ctx context.Context, tokenHash string) (*domain.Share, error)
+	Delete(ctx context.Context, opIdCond string) (int, error)
 }
 
 type oaiRepo interface {
-	GetRun(threadId string, runId string) (*OAIRun, error)
-	PostRun(assistantId string, threadId string) (*OAIRun, error)
-	GetMsgs(threadId string) (*[]OAIMessage, error)
-	PostMsg(proto MessageProto, threadId string) error
-	PostThread() (string, error)
-	DeleteThread(threadId string) error
+	GetRun(ctx context.Context, threadId string, runId string) (*OAIRun, error)
+	PostRun(ctx context.Context, assistantId string, threadId string) (*OAIRun, error)
+	GetMsgs(ctx context.Context, threadId string) (*[]OAIMessage, error)
+	PostMsg(ctx context.Context, proto MessageProto, threadId string) error
+	PostThread(ctx context.Context) (string, error)
+	DeleteThread(ctx context.Context, threadId string) error
+	PostCompletion(ctx context.Context, proto CompletionProto) (*OAICompletion, error)
+}
+
+type evalRepo interface {
+	Insert(ctx context.Context, evaluation domain.Evaluation) error
+	Update(ctx context.Context, id string, state string) error
+	Read(ctx context.Context, id string) (*domain.Evaluation, error)
+	ReadMany(ctx context.Context, opIdCond string) (*[]domain.Evaluation, error)
+	Delete(ctx context.Context, opIdCond string) (int, error)
+}
+
+type AutoRunUpdateOpts struct {
+	State      string `json:"state"`
+	StopReason string `json:"stop_reason"`
+	BestId     string `json:"best_id"`
+	Iterations int    `json:"iterations"`
+	Spent      int    `json:"spent"`
+}
+
+type autoRunRepo interface {
+	Insert(ctx context.Context, run domain.AutoRun) error
+	Update(ctx context.Context, id string, opts AutoRunUpdateOpts) error
+	Read(ctx context.Context, id string) (*domain.AutoRun, error)
+	ReadMany(ctx context.Context, opIdCond string) (*[]domain.AutoRun, error)
+	Delete(ctx context.Context, opIdCond string) (int, error)
+}
+
+type evalCaseRepo interface {
+	Insert(ctx context.Context, cases []domain.EvaluationCase) error
+	Read(ctx context.Context, evaluationId string) (*[]domain.EvaluationCase, error)
+	Delete(ctx context.Context, opIdCond string) (int, error)
 }
 
 type phRepo interface {
-	Capture(eventType string, opid string) error
+	Capture(ctx context.Context, eventType string, opid string) error
 }
 
 type Repo struct {
-	OpRepo   opRepo
-	RunRepo  runRepo
-	SuggRepo suggRepo
-	OAIRepo  oaiRepo
-	PHRepo   phRepo
+	OpRepo       opRepo
+	RunRepo      runRepo
+	SuggRepo     suggRepo
+	FeedbRepo    feedbRepo
+	ProfRepo     profileRepo
+	ShareRepo    shareRepo
+	BatchRepo    batchRepo
+	LibRepo      libraryRepo
+	EvalRepo     evalRepo
+	EvalCaseRepo evalCaseRepo
+	AutoRunRepo  autoRunRepo
+	AnalyzerRepo customAnalyzerRepo
+	OAIRepo      oaiRepo
+	PHRepo       phRepo
 }
 
 type App struct {
@@ -94,6 +282,7 @@ func (a App) rateLimit(limiter *rate.Limiter) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if !limiter.Allow() {
+				rateLimited.Inc(observe(r.Context()).route)
 				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
 				return
 			}
@@ -105,12 +294,17 @@ func (a App) rateLimit(limiter *rate.Limiter) func(http.Handler) http.Handler {
 func (a App) registerEndpoints(h *http.ServeMux) {
 	limiter := rate.NewLimiter(2, 2)
 
+	h.Handle("/metrics", metrics.Handler())
 	h.Handle("/static/",
 		http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 
 	h.Handle("/", a.rateLimit(limiter)(AppHandler{IndexController{ComponentBuilder: &a.ComponentBuilder}}))
 	h.Handle("/app", a.rateLimit(limiter)(AppHandler{AppController{ComponentBuilder: &a.ComponentBuilder}}))
-	h.Handle("/editor/draft", a.rateLimit(limiter)(AppHandler{DraftModeEditorController{ComponentBuilder: &a.ComponentBuilder}}))
+	h.Handle("/editor/draft", a.rateLimit(limiter)(AppHandler{DraftModeEditorController{
+		ComponentBuilder: &a.ComponentBuilder,
+		Repo:             &a.Repo,
+		Config:           &a.Config,
+	}}))
 	h.Handle("/suggestions", a.rateLimit(limiter)(AppHandler{SuggestionController{
 		ComponentBuilder: &a.ComponentBuilder,
 		Repo:             &a.Repo,
@@ -121,6 +315,61 @@ func (a App) registerEndpoints(h *http.ServeMux) {
 		Repo:             &a.Repo,
 		Config:           &a.Config,
 	}}))
+	h.Handle("/history", a.rateLimit(limiter)(AppHandler{HistoryController{
+		ComponentBuilder: &a.ComponentBuilder,
+		Repo:             &a.Repo,
+		Config:           &a.Config,
+	}}))
+	h.Handle("/shares", a.rateLimit(limiter)(AppHandler{ShareController{
+		ComponentBuilder: &a.ComponentBuilder,
+		Repo:             &a.Repo,
+		Config:           &a.Config,
+	}}))
+	h.Handle("/o/", a.rateLimit(limiter)(AppHandler{SharedController{
+		ComponentBuilder: &a.ComponentBuilder,
+		Repo:             &a.Repo,
+		Config:           &a.Config,
+	}}))
+	h.Handle("/evaluations", a.rateLimit(limiter)(AppHandler{EvaluationController{
+		ComponentBuilder: &a.ComponentBuilder,
+		Repo:             &a.Repo,
+		Config:           &a.Config,
+	}}))
+	h.Handle("/autoruns", a.rateLimit(limiter)(AppHandler{AutoRunController{
+		ComponentBuilder: &a.ComponentBuilder,
+		Repo:             &a.Repo,
+		Config:           &a.Config,
+	}}))
+	h.Handle("/analyzers", a.rateLimit(limiter)(AppHandler{AnalyzerController{
+		ComponentBuilder: &a.ComponentBuilder,
+		Repo:             &a.Repo,
+		Config:           &a.Config,
+	}}))
+	h.Handle("/search", a.rateLimit(limiter)(AppHandler{SearchController{
+		ComponentBuilder: &a.ComponentBuilder,
+		Repo:             &a.Repo,
+		Config:           &a.Config,
+	}}))
+	h.Handle("/prompts", a.rateLimit(limiter)(AppHandler{LibraryController{
+		ComponentBuilder: &a.ComponentBuilder,
+		Repo:             &a.Repo,
+		Config:           &a.Config,
+	}}))
+	h.Handle("/batches", a.rateLimit(limiter)(AppHandler{BatchController{
+		ComponentBuilder: &a.ComponentBuilder,
+		Repo:             &a.Repo,
+		Config:           &a.Config,
+	}}))
+	h.Handle("/exports", a.rateLimit(limiter)(AppHandler{ExportController{
+		ComponentBuilder: &a.ComponentBuilder,
+		Repo:             &a.Repo,
+		Config:           &a.Config,
+	}}))
+	h.Handle("/profile", a.rateLimit(limiter)(AppHandler{ProfileController{
+		ComponentBuilder: &a.ComponentBuilder,
+		Repo:             &a.Repo,
+		Config:           &a.Config,
+	}}))
 	h.Handle("/captures", a.rateLimit(limiter)(AppHandler{CaptureController{
 		ComponentBuilder: &a.ComponentBuilder,
 		Repo:             &a.Repo,
@@ -128,6 +377,10 @@ func (a App) registerEndpoints(h *http.ServeMux) {
 	}}))
 }
 
+// shutdownTimeout is how long requests in flight may take once the server is stopped
+const shutdownTimeout = 10 * time.Second
+
+// Start serves requests until the process is interrupted or terminated
 func (a App) Start() {
 	mux := http.NewServeMux()
 
@@ -138,9 +391,33 @@ func (a App) Start() {
 		ReadHeaderTimeout: 500 * time.Millisecond,
 		ReadTimeout:       5 * time.Second,
 		WriteTimeout:      5 * time.Second,
-		Handler:           http.TimeoutHandler(mux, time.Second, "Timeout of server handler"),
+		Handler:           instrument(mux, http.TimeoutHandler(mux, time.Second, "Timeout of server handler")),
 	}
 
-	log.Fatal(s.ListenAndServe())
-	log.Printf("App running on %s...", a.Config.Port)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go a.sweepRetention(ctx)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.ListenAndServe()
+	}()
+
+	slog.Info("App running", "port", a.Config.Port)
+
+	select {
+	case err := <-errs:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Shutting down server failed", "error", err)
+	}
 }
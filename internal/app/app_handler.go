@@ -2,9 +2,7 @@ package app
 
 import (
 	"context"
-	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
 )
 
@@ -30,11 +28,15 @@ type AppHandler struct {
 
 func (h AppHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	resp := h.c.Handle(w, r)
+	observe(r.Context()).code = resp.Code
 
 	if resp.Error != nil {
-		slog.Error(fmt.Sprintf(`Error occured: %s`, resp.Error.Error()))
+		logger(r.Context()).Error("Request failed", "code", resp.Code, "message", resp.Message, "error", resp.Error)
 	}
 
+	// Headers have to be set before the status code is written
+	w.Header().Add("Content-Type", resp.ContentType)
+
 	if resp.Code != 0 {
 
 		// Overwrite error code to allow for component rendering on client
@@ -44,7 +46,6 @@ func (h AppHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		w.WriteHeader(resp.Code)
 	}
-	w.Header().Add("Content-Type", resp.ContentType)
 
 	if resp.Component == nil {
 		return
@@ -53,7 +54,7 @@ func (h AppHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	err := resp.Component.Render(r.Context(), w)
 
 	if err != nil {
-		slog.Error(fmt.Sprintf(`Error occured: %s`, err.Error()))
+		logger(r.Context()).Error("Rendering component failed", "error", err)
 		http.Error(w, "templ: failed to render template", 500)
 	}
 }
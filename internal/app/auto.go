@@ -0,0 +1,220 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAutoTargetScore   = 8
+	defaultAutoMaxIterations = 3
+	defaultAutoMaxSpend      = 100000
+	maxAutoIterations        = 10
+	// versions that improve the best score by less than autoPlateauDelta count as stale, runs stop
+	// after autoPlateauPatience stale versions in a row
+	autoPlateauDelta    = 0.25
+	autoPlateauPatience = 2
+)
+
+type autoRunReq struct {
+	TargetScore   formNumber `json:"target_score"`
+	MaxIterations formNumber `json:"max_iterations"`
+	MaxSpend      formNumber `json:"max_spend"`
+}
+
+func (r autoRunReq) autoRun(op domain.Optimization, sessionId string) (*domain.AutoRun, error) {
+	if r.TargetScore <= 0 || r.TargetScore > 10 {
+		return nil, errors.New("the target score has to be between 0 and 10")
+	}
+	if r.MaxIterations < 1 || r.MaxIterations > maxAutoIterations {
+		return nil, fmt.Errorf("the number of iterations has to be between 1 and %d", maxAutoIterations)
+	}
+	if r.MaxSpend < 1 {
+		return nil, errors.New("the maximum spend has to be at least 1 token")
+	}
+
+	return &domain.AutoRun{
+		Id:             uuid.New().String(),
+		OptimizationId: op.Id,
+		SessionId:      sessionId,
+		TargetScore:    float64(r.TargetScore),
+		MaxIterations:  int(r.MaxIterations),
+		MaxSpend:       int(r.MaxSpend),
+		State:          "running",
+		BestId:         op.Id}, nil
+}
+
+type AutoRunForm struct {
+	OptimizationId string
+	TargetScore    float64
+	MaxIterations  int
+	MaxSpend       int
+	ErrMsg         string
+	Past           []domain.AutoRun
+}
+
+// AutoIteration is a version of an auto run. Position 0 is the optimization the run started from.
+type AutoIteration struct {
+	Optimization domain.Optimization
+	Position     int
+	Score        float64
+	Scored       bool
+	Best         bool
+}
+
+type AutoRunView struct {
+	Run        domain.AutoRun
+	Iterations []AutoIteration
+}
+
+func (v AutoRunView) Finished() bool {
+	return v.Run.State != "running"
+}
+
+// versionScore is the average score the analyzers gave the optimized prompt of a version
+func versionScore(ctx context.Context, repo *Repo, opId string) (float64, bool, error) {
+	scores, err := readScorecard(ctx, repo, opId)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	_, after, ok := scores.Averages()
+
+	return after, ok, nil
+}
+
+func readAutoRunView(ctx context.Context, repo *Repo, run domain.AutoRun) (*AutoRunView, error) {
+	origin, err := repo.OpRepo.Read(ctx, run.OptimizationId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := repo.OpRepo.ReadMany(ctx, OpReadFilter{AutoRunIdCond: fmt.Sprintf("eq.%s", run.Id)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(*versions, func(i, j int) bool {
+		return (*versions)[i].CreatedAt < (*versions)[j].CreatedAt
+	})
+
+	all := append([]domain.Optimization{*origin}, *versions...)
+
+	view := AutoRunView{Run: run, Iterations: make([]AutoIteration, len(all))}
+	for i := 0; i < len(all); i++ {
+		score, scored, err := versionScore(ctx, repo, all[i].Id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		view.Iterations[i] = AutoIteration{Optimization: all[i], Position: i, Score: score, Scored: scored,
+			Best: all[i].Id == run.BestId}
+	}
+
+	return &view, nil
+}
+
+// autoOptimize regenerates the optimized prompt of the origin over and over, every version
+// starting from the optimized prompt of the previous one
+func (c OptimizationController) autoOptimize(ctx context.Context, run domain.AutoRun, origin domain.Optimization) {
+	ctx = withLog(ctx, "auto_run_id", run.Id)
+	opts := AutoRunUpdateOpts{State: "completed", StopReason: "max_iterations", BestId: origin.Id}
+
+	bestScore, scored, err := versionScore(ctx, c.Repo, origin.Id)
+
+	if err != nil {
+		logger(ctx).Error("Scoring origin failed", "error", err)
+	}
+
+	current := origin
+	stale := 0
+	for opts.Iterations < run.MaxIterations {
+		if scored && bestScore >= run.TargetScore {
+			opts.StopReason = "target_reached"
+			break
+		} else if opts.Spent >= run.MaxSpend {
+			opts.StopReason = "spend_exhausted"
+			break
+		}
+
+		version := domain.Optimization{
+			Id:              uuid.New().String(),
+			OriginalPrompt:  current.OptimizedPrompt,
+			Instructions:    current.Instructions,
+			MaxTokens:       current.MaxTokens,
+			Analyzers:       current.Analyzers,
+			Redactions:      current.Redactions,
+			ParentId:        current.Id,
+			SessionId:       run.SessionId,
+			LibraryPromptId: current.LibraryPromptId,
+			AutoRunId:       run.Id,
+			State:           "pending"}
+
+		c.start(withLog(ctx, "optimization_id", version.Id), version)
+
+		done, err := c.Repo.OpRepo.Read(ctx, version.Id)
+
+		if err != nil || done.State != "completed" {
+			if err != nil {
+				logger(ctx).Error("Reading version failed", "error", err)
+			}
+			opts.State = "failed"
+			opts.StopReason = "failed"
+			break
+		}
+
+		opts.Iterations++
+		opts.Spent += done.TokensUsed
+
+		score, ok, err := versionScore(ctx, c.Repo, done.Id)
+
+		if err != nil {
+			logger(ctx).Error("Scoring version failed", "error", err)
+		}
+
+		if ok && (!scored || score-bestScore >= autoPlateauDelta) {
+			stale = 0
+		} else {
+			stale++
+		}
+
+		if ok && (!scored || score > bestScore) {
+			bestScore, scored = score, true
+			opts.BestId = done.Id
+		}
+
+		if err := c.Repo.AutoRunRepo.Update(ctx, run.Id, AutoRunUpdateOpts{State: "running", BestId: opts.BestId,
+			Iterations: opts.Iterations, Spent: opts.Spent}); err != nil {
+			logger(ctx).Error("Updating auto run failed", "error", err)
+		}
+
+		if scored && bestScore >= run.TargetScore {
+			opts.StopReason = "target_reached"
+			break
+		} else if opts.Spent >= run.MaxSpend {
+			// a version runs to completion, so the last one may have consumed more than was left
+			opts.StopReason = "spend_exhausted"
+			break
+		} else if stale >= autoPlateauPatience {
+			opts.StopReason = "plateaued"
+			break
+		}
+
+		current = *done
+	}
+
+	if err := c.Repo.AutoRunRepo.Update(ctx, run.Id, opts); err != nil {
+		logger(ctx).Error("Updating auto run failed", "error", err)
+	}
+
+	logger(ctx).Info("Auto run stopped", "iterations", opts.Iterations, "reason", opts.StopReason)
+}
@@ -0,0 +1,268 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+const (
+	maxBatchUploadSize = 5 << 20
+	maxBatchItems      = 500
+)
+
+type batchItem struct {
+	Id           string `json:"id"`
+	Prompt       string `json:"prompt"`
+	Instructions string `json:"instructions"`
+}
+
+// BatchProgress is the state of a batch and its optimizations
+type BatchProgress struct {
+	Batch     domain.Batch
+	Completed int
+	// Failed optimizations are done as well, they have no optimized prompt
+	Failed  int
+	Pending int
+}
+
+func (p BatchProgress) Finished() bool {
+	return p.Batch.State == "completed"
+}
+
+// Done counts the optimizations that completed or failed
+func (p BatchProgress) Done() int {
+	return p.Completed + p.Failed
+}
+
+func (p BatchProgress) Percent() int {
+	if p.Batch.Total == 0 {
+		return 0
+	}
+
+	return p.Done() * 100 / p.Batch.Total
+}
+
+func parseCSVBatch(content []byte) ([]batchItem, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{"id": -1, "prompt": -1, "instructions": -1}
+	for i := 0; i < len(header); i++ {
+		name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+		if _, ok := columns[name]; ok {
+			columns[name] = i
+		}
+	}
+
+	if columns["prompt"] == -1 {
+		return nil, errors.New("missing prompt column")
+	}
+
+	value := func(record []string, column string) string {
+		i := columns[column]
+		if i == -1 || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	var items []batchItem
+	for {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		items = append(items, batchItem{
+			Id:           value(record, "id"),
+			Prompt:       value(record, "prompt"),
+			Instructions: value(record, "instructions")})
+	}
+
+	return items, nil
+}
+
+func parseJSONLBatch(content []byte) ([]batchItem, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBatchUploadSize)
+
+	var items []batchItem
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		// ids are accepted as strings and numbers
+		var raw struct {
+			Id           json.RawMessage `json:"id"`
+			Prompt       string          `json:"prompt"`
+			Instructions string          `json:"instructions"`
+		}
+		if err := json.Unmarshal([]byte(text), &raw); err != nil {
+			return nil, fmt.Errorf("invalid JSON on line %d: %s", line, err.Error())
+		}
+
+		id := strings.Trim(string(raw.Id), `"`)
+		if id == "null" {
+			id = ""
+		}
+
+		items = append(items, batchItem{Id: id, Prompt: raw.Prompt, Instructions: raw.Instructions})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// parseBatch reads CSV files with a header row and JSONL files. Both require a prompt and
+// accept optional instructions and id columns.
+func parseBatch(filename string, content []byte) ([]batchItem, error) {
+	var items []batchItem
+	var err error
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jsonl", ".ndjson", ".json":
+		items, err = parseJSONLBatch(content)
+	case ".csv":
+		items, err = parseCSVBatch(content)
+	default:
+		if bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+			items, err = parseJSONLBatch(content)
+		} else {
+			items, err = parseCSVBatch(content)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, errors.New("batch contains no prompts")
+	} else if len(items) > maxBatchItems {
+		return nil, fmt.Errorf("batch exceeds the limit of %d prompts", maxBatchItems)
+	}
+
+	for i := 0; i < len(items); i++ {
+		if strings.TrimSpace(items[i].Prompt) == "" {
+			return nil, fmt.Errorf("prompt of item %d is empty", i+1)
+		}
+	}
+
+	return items, nil
+}
+
+type batchResult struct {
+	Id              string `json:"id"`
+	ExternalId      string `json:"external_id"`
+	State           string `json:"state"`
+	OriginalPrompt  string `json:"original_prompt"`
+	Instructions    string `json:"instructions"`
+	OptimizedPrompt string `json:"optimized_prompt"`
+	Suggestions     int    `json:"suggestions"`
+}
+
+func readBatchResults(ctx context.Context, repo *Repo, config *Config, batchId string) ([]batchResult, error) {
+	ops, err := repo.OpRepo.ReadMany(ctx, OpReadFilter{BatchIdCond: fmt.Sprintf("eq.%s", batchId)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]batchResult, len(*ops))
+	if len(*ops) == 0 {
+		return results, nil
+	}
+
+	suggs, err := repo.SuggRepo.Read(ctx, SuggReadFilter{OpIdCond: inCond(lineageIds(*ops))})
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < len(*suggs); i++ {
+		counts[(*suggs)[i].OptimizationId]++
+	}
+
+	for i := 0; i < len(*ops); i++ {
+		op, err := restoreOptimization(config, (*ops)[i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		results[i] = batchResult{
+			Id:              op.Id,
+			ExternalId:      op.ExternalId,
+			State:           op.State,
+			OriginalPrompt:  op.OriginalPrompt,
+			Instructions:    op.Instructions,
+			OptimizedPrompt: op.OptimizedPrompt,
+			Suggestions:     counts[op.Id]}
+	}
+
+	return results, nil
+}
+
+func batchResultsCSV(results []batchResult) ([]byte, error) {
+	var b bytes.Buffer
+	writer := csv.NewWriter(&b)
+
+	err := writer.Write([]string{"id", "external_id", "state", "original_prompt", "instructions", "optimized_prompt", "suggestions"})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(results); i++ {
+		result := results[i]
+		err = writer.Write([]string{result.Id, result.ExternalId, result.State, result.OriginalPrompt,
+			result.Instructions, result.OptimizedPrompt, strconv.Itoa(result.Suggestions)})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+
+	return b.Bytes(), writer.Error()
+}
+
+func batchResultsJSONL(results []batchResult) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+
+	for i := 0; i < len(results); i++ {
+		if err := encoder.Encode(results[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+var chatRoles = []string{"system", "user", "assistant"}
+
+// parseChatPrompt reads prompts that are JSON arrays of role and content messages
+func parseChatPrompt(prompt string) ([]domain.ChatMessage, bool) {
+	trimmed := strings.TrimSpace(prompt)
+	if !strings.HasPrefix(trimmed, "[") {
+		return nil, false
+	}
+
+	var messages []domain.ChatMessage
+	if err := json.Unmarshal([]byte(trimmed), &messages); err != nil || len(messages) == 0 {
+		return nil, false
+	}
+
+	for i := 0; i < len(messages); i++ {
+		if !contains(chatRoles, messages[i].Role) {
+			return nil, false
+		}
+	}
+
+	return messages, true
+}
+
+// formatChatPrompt is the stored representation of chat prompts
+func formatChatPrompt(messages []domain.ChatMessage) (string, error) {
+	formatted, err := json.MarshalIndent(messages, "", "  ")
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(formatted), nil
+}
+
+// prompt returns the prompt of the request. Chat prompts can be sent as messages or as a JSON
+// array in the prompt field and are stored in the same format either way.
+func (r optimizationReq) prompt() (string, error) {
+	messages := r.Messages
+	if len(messages) == 0 {
+		var ok bool
+		if messages, ok = parseChatPrompt(r.OriginalPrompt); !ok {
+			return r.OriginalPrompt, nil
+		}
+	}
+
+	for i := 0; i < len(messages); i++ {
+		if !contains(chatRoles, messages[i].Role) {
+			return "", fmt.Errorf("invalid role %s of message %d", messages[i].Role, i)
+		}
+	}
+
+	return formatChatPrompt(messages)
+}
+
+func chatMessagesCtx(messages []domain.ChatMessage) string {
+	var b strings.Builder
+
+	for i := 0; i < len(messages); i++ {
+		b.WriteString(fmt.Sprintf(`[Message %d, role: %s]
+		%s
+
+		`, i, messages[i].Role, messages[i].Content))
+	}
+
+	return b.String()
+}
+
+// chatAnalyzerCtx presents a chat prompt to analyzers message by message
+func chatAnalyzerCtx(messages []domain.ChatMessage) string {
+	return fmt.Sprintf(`The model instructions are a chat prompt of %d messages. Evaluate every message with regard to its role:
+		the system message sets up the model, user and assistant messages before the last one are few-shot examples
+		and the last user message is the template of the actual request.
+		Add the field 'message_index' to every suggestion, which is the number of the message the suggestion targets.
+		The 'original' field has to quote text of that message.
+
+		%s`, len(messages), chatMessagesCtx(messages))
+}
+
+// chatOperatorCtx asks the operator to return the improved chat prompt in the same structure
+func chatOperatorCtx(messages []domain.ChatMessage) string {
+	return fmt.Sprintf(`The model instructions are a chat prompt of %d messages. Every suggestion's 'message_index' refers to the message it applies to.
+		Return the improved chat prompt as a JSON array of objects with the fields 'role' and 'content' and nothing else.
+		Keep the number, order and roles of the messages.
+
+		%s`, len(messages), chatMessagesCtx(messages))
+}
+
+// parseOperatorChat reads the chat prompt returned by the operator and makes sure it has the
+// structure of the original one
+func parseOperatorChat(msg []byte, original []domain.ChatMessage) ([]domain.ChatMessage, error) {
+	content := bytes.TrimSpace(msg)
+	content = bytes.TrimPrefix(content, []byte("```json"))
+	content = bytes.TrimPrefix(content, []byte("```"))
+	content = bytes.TrimSuffix(content, []byte("```"))
+
+	var messages []domain.ChatMessage
+	if err := json.Unmarshal(bytes.TrimSpace(content), &messages); err != nil {
+		return nil, err
+	}
+
+	if len(messages) != len(original) {
+		return nil, fmt.Errorf("operator returned %d instead of %d messages", len(messages), len(original))
+	}
+
+	for i := 0; i < len(messages); i++ {
+		if messages[i].Role != original[i].Role {
+			return nil, errors.New("operator changed the roles of the messages")
+		}
+	}
+
+	return messages, nil
+}
+
+func sameMessage(a domain.Suggestion, b domain.Suggestion) bool {
+	if a.MessageIndex == nil || b.MessageIndex == nil {
+		return a.MessageIndex == b.MessageIndex
+	}
+
+	return *a.MessageIndex == *b.MessageIndex
+}
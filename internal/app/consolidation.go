@@ -0,0 +1,156 @@
+package app
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+const similarityThreshold = 0.5
+
+type span struct {
+	Start int
+	End   int
+}
+
+func tokenize(text string) map[string]bool {
+	tokens := make(map[string]bool)
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	for i := 0; i < len(words); i++ {
+		tokens[words[i]] = true
+	}
+
+	return tokens
+}
+
+// similarity returns the jaccard index of the word sets of a and b
+func similarity(a string, b string) float64 {
+	tokensA := tokenize(a)
+	tokensB := tokenize(b)
+
+	if len(tokensA) == 0 && len(tokensB) == 0 {
+		return 1
+	}
+
+	intersection := 0
+	for token := range tokensA {
+		if tokensB[token] {
+			intersection++
+		}
+	}
+
+	union := len(tokensA) + len(tokensB) - intersection
+
+	return float64(intersection) / float64(union)
+}
+
+func findSpan(prompt string, target string) (span, bool) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return span{}, false
+	}
+
+	start := strings.Index(prompt, target)
+	if start == -1 {
+		return span{}, false
+	}
+
+	return span{Start: start, End: start + len(target)}, true
+}
+
+func targetsOverlap(prompt string, a string, b string) bool {
+	spanA, okA := findSpan(prompt, a)
+	spanB, okB := findSpan(prompt, b)
+
+	if okA && okB {
+		return spanA.Start < spanB.End && spanB.Start < spanA.End
+	}
+
+	// targets that can't be located in the prompt are compared by their text
+	return similarity(a, b) >= similarityThreshold
+}
+
+// targetText is the text the suggestion's target is located in. Targets of chat prompts refer to
+// the content of their message, not to the JSON encoded message list.
+func targetText(prompt string, messages []domain.ChatMessage, sugg domain.Suggestion) string {
+	if sugg.MessageIndex != nil && *sugg.MessageIndex >= 0 && *sugg.MessageIndex < len(messages) {
+		return messages[*sugg.MessageIndex].Content
+	}
+
+	return prompt
+}
+
+func isDuplicate(prompt string, messages []domain.ChatMessage, a domain.Suggestion, b domain.Suggestion) bool {
+	return sameMessage(a, b) && targetsOverlap(targetText(prompt, messages, a), a.Target, b.Target) &&
+		similarity(a.Suggestion, b.Suggestion) >= similarityThreshold
+}
+
+// disjoint reports whether no analyzer is in both lists
+func disjoint(a []string, b []string) bool {
+	for i := 0; i < len(b); i++ {
+		if contains(a, b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// consolidate merges suggestions of different analyzers that propose near identical edits
+// to overlapping parts of the prompt. The first suggestion of a group is kept and records
+// which analyzers agreed on it. Similar suggestions of the same analyzer are kept apart. The
+// messages are those of chat prompts, they are empty for plain prompts.
+func consolidate(prompt string, messages []domain.ChatMessage, suggestions []domain.Suggestion) []domain.Suggestion {
+	var merged []domain.Suggestion
+
+	for i := 0; i < len(suggestions); i++ {
+		sugg := suggestions[i]
+		if len(sugg.Analyzers) == 0 {
+			sugg.Analyzers = []string{sugg.Type}
+		}
+
+		duplicate := false
+		for j := 0; j < len(merged); j++ {
+			if !disjoint(merged[j].Analyzers, sugg.Analyzers) || !isDuplicate(prompt, messages, merged[j], sugg) {
+				continue
+			}
+
+			if severityRank(sugg.Severity) < severityRank(merged[j].Severity) {
+				merged[j].Severity = sugg.Severity
+			}
+			if sugg.Impact > merged[j].Impact {
+				merged[j].Impact = sugg.Impact
+			}
+
+			for k := 0; k < len(sugg.Analyzers); k++ {
+				if !contains(merged[j].Analyzers, sugg.Analyzers[k]) {
+					merged[j].Analyzers = append(merged[j].Analyzers, sugg.Analyzers[k])
+				}
+			}
+
+			duplicate = true
+			break
+		}
+
+		if !duplicate {
+			merged = append(merged, sugg)
+		}
+	}
+
+	return merged
+}
+
+func contains(values []string, value string) bool {
+	for i := 0; i < len(values); i++ {
+		if values[i] == value {
+			return true
+		}
+	}
+
+	return false
+}
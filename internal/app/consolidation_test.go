@@ -0,0 +1,125 @@
+package app
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+func messageIndex(i int) *int {
+	return &i
+}
+
+func TestConsolidate(t *testing.T) {
+	prompt := "You are a helpful assistant. Answer in short sentences and avoid jargon."
+
+	messages := []domain.ChatMessage{
+		{Role: "system", Content: "Reply \"yes\" or \"no\".\nNever explain the answer."},
+		{Role: "user", Content: "Reply \"yes\" or \"no\".\nIs the sky blue?"},
+	}
+	encoded, err := json.Marshal(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		prompt      string
+		messages    []domain.ChatMessage
+		suggestions []domain.Suggestion
+		analyzers   [][]string
+	}{
+		{
+			name:   "identical targets",
+			prompt: prompt,
+			suggestions: []domain.Suggestion{
+				{Type: "clarity", Target: "short sentences", Suggestion: "Answer in at most two sentences"},
+				{Type: "specificity", Target: "short sentences", Suggestion: "Answer in at most two sentences"},
+			},
+			analyzers: [][]string{{"clarity", "specificity"}},
+		},
+		{
+			name:   "near duplicates",
+			prompt: prompt,
+			suggestions: []domain.Suggestion{
+				{Type: "clarity", Target: "Answer in short sentences", Suggestion: "Answer in at most two short sentences"},
+				{Type: "specificity", Target: "short sentences", Suggestion: "Answer in two short sentences at most"},
+			},
+			analyzers: [][]string{{"clarity", "specificity"}},
+		},
+		{
+			name:   "same analyzer",
+			prompt: prompt,
+			suggestions: []domain.Suggestion{
+				{Type: "clarity", Target: "short sentences", Suggestion: "Answer in at most two sentences"},
+				{Type: "clarity", Target: "short sentences", Suggestion: "Answer in at most two sentences"},
+			},
+			analyzers: [][]string{{"clarity"}, {"clarity"}},
+		},
+		{
+			name:   "different edits",
+			prompt: prompt,
+			suggestions: []domain.Suggestion{
+				{Type: "clarity", Target: "short sentences", Suggestion: "Answer in at most two sentences"},
+				{Type: "specificity", Target: "short sentences", Suggestion: "Use a bulleted list"},
+			},
+			analyzers: [][]string{{"clarity"}, {"specificity"}},
+		},
+		{
+			name:   "separate targets",
+			prompt: prompt,
+			suggestions: []domain.Suggestion{
+				{Type: "clarity", Target: "helpful assistant", Suggestion: "Avoid jargon in answers"},
+				{Type: "specificity", Target: "avoid jargon", Suggestion: "Avoid jargon in answers"},
+			},
+			analyzers: [][]string{{"clarity"}, {"specificity"}},
+		},
+		{
+			name:     "chat targets overlapping in a message",
+			prompt:   string(encoded),
+			messages: messages,
+			suggestions: []domain.Suggestion{
+				{Type: "clarity", Target: "Reply \"yes\"", Suggestion: "Reply with yes or no only", MessageIndex: messageIndex(0)},
+				{Type: "specificity", Target: "\"yes\" or \"no\".\nNever", Suggestion: "Reply with only yes or no", MessageIndex: messageIndex(0)},
+			},
+			analyzers: [][]string{{"clarity", "specificity"}},
+		},
+		{
+			name:     "chat targets in different messages",
+			prompt:   string(encoded),
+			messages: messages,
+			suggestions: []domain.Suggestion{
+				{Type: "clarity", Target: "Reply \"yes\" or \"no\".", Suggestion: "Reply with yes or no only", MessageIndex: messageIndex(0)},
+				{Type: "specificity", Target: "Reply \"yes\" or \"no\".", Suggestion: "Reply with yes or no only", MessageIndex: messageIndex(1)},
+			},
+			analyzers: [][]string{{"clarity"}, {"specificity"}},
+		},
+		{
+			name:     "chat targets apart in a message",
+			prompt:   string(encoded),
+			messages: messages,
+			suggestions: []domain.Suggestion{
+				{Type: "clarity", Target: "Reply \"yes\" or \"no\".", Suggestion: "Explain the answer", MessageIndex: messageIndex(0)},
+				{Type: "specificity", Target: "Never explain the answer.", Suggestion: "Explain the answer", MessageIndex: messageIndex(0)},
+			},
+			analyzers: [][]string{{"clarity"}, {"specificity"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := consolidate(tt.prompt, tt.messages, tt.suggestions)
+
+			var got [][]string
+			for i := 0; i < len(merged); i++ {
+				got = append(got, merged[i].Analyzers)
+			}
+
+			if !reflect.DeepEqual(got, tt.analyzers) {
+				t.Errorf("got %v, want %v", got, tt.analyzers)
+			}
+		})
+	}
+}
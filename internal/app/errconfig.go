@@ -14,6 +14,22 @@ func get400() errConfig {
 	}
 }
 
+func get403() errConfig {
+	return errConfig{
+		Code:  403,
+		Title: "Forbidden",
+		Msg:   "Sorry, you don't have access to this page.",
+	}
+}
+
+func get404() errConfig {
+	return errConfig{
+		Code:  404,
+		Title: "Not found",
+		Msg:   "Sorry, this link is invalid, has expired or was revoked.",
+	}
+}
+
 func get405() errConfig {
 	return errConfig{
 		Code:  405,
@@ -0,0 +1,501 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+	"github.com/google/uuid"
+)
+
+const (
+	maxEvalInputs      = 20
+	maxEvalInputLength = 4000
+	evalConcurrency    = 4
+	evalMaxTokens      = 1024
+	evalInputSeparator = "---"
+)
+
+var evalModels = []string{"gpt-3.5-turbo", "gpt-4-turbo-preview", "gpt-4"}
+
+type evaluationReq struct {
+	Inputs     string `json:"inputs"`
+	Assertions string `json:"assertions"`
+	Model      string `json:"model"`
+	Judge      string `json:"judge"`
+}
+
+// parseEvalInputs splits sample inputs on lines that only contain the separator
+func parseEvalInputs(raw string) []string {
+	var inputs []string
+	var current []string
+
+	flush := func() {
+		input := strings.TrimSpace(strings.Join(current, "\n"))
+		if input != "" {
+			inputs = append(inputs, input)
+		}
+		current = nil
+	}
+
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == evalInputSeparator {
+			flush()
+			continue
+		}
+		current = append(current, lines[i])
+	}
+	flush()
+
+	return inputs
+}
+
+// assertion is a rule every output is checked against, written as `kind: argument`
+type assertion struct {
+	Kind string
+	Arg  string
+	re   *regexp.Regexp
+	max  int
+}
+
+func (a assertion) String() string {
+	if a.Arg == "" {
+		return a.Kind
+	}
+
+	return fmt.Sprintf("%s: %s", a.Kind, a.Arg)
+}
+
+func (a assertion) check(output string) bool {
+	switch a.Kind {
+	case "contains":
+		return strings.Contains(strings.ToLower(output), strings.ToLower(a.Arg))
+	case "not_contains":
+		return !strings.Contains(strings.ToLower(output), strings.ToLower(a.Arg))
+	case "regex":
+		return a.re.MatchString(output)
+	case "max_length":
+		return len([]rune(output)) <= a.max
+	case "json":
+		return json.Valid([]byte(strings.TrimSpace(output)))
+	default:
+		return false
+	}
+}
+
+func parseAssertion(raw string) (*assertion, error) {
+	kind, arg, _ := strings.Cut(raw, ":")
+	a := assertion{Kind: strings.ToLower(strings.TrimSpace(kind)), Arg: strings.TrimSpace(arg)}
+
+	switch a.Kind {
+	case "contains", "not_contains":
+		if a.Arg == "" {
+			return nil, fmt.Errorf("assertion %s requires a text", a.Kind)
+		}
+	case "regex":
+		re, err := regexp.Compile(a.Arg)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex assertion: %s", err.Error())
+		}
+
+		a.re = re
+	case "max_length":
+		max, err := strconv.Atoi(a.Arg)
+
+		if err != nil || max <= 0 {
+			return nil, errors.New("max_length assertion requires a positive number")
+		}
+
+		a.max = max
+	case "json":
+		a.Arg = ""
+	default:
+		return nil, fmt.Errorf("unknown assertion %s", a.Kind)
+	}
+
+	return &a, nil
+}
+
+func parseAssertions(raw []string) ([]assertion, error) {
+	var assertions []assertion
+
+	for i := 0; i < len(raw); i++ {
+		if strings.TrimSpace(raw[i]) == "" {
+			continue
+		}
+
+		a, err := parseAssertion(raw[i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		assertions = append(assertions, *a)
+	}
+
+	return assertions, nil
+}
+
+// evaluation validates the request and creates the evaluation it describes
+func (r evaluationReq) evaluation(op domain.Optimization, sessionId string) (*domain.Evaluation, []string, error) {
+	inputs := parseEvalInputs(r.Inputs)
+
+	if len(inputs) == 0 {
+		return nil, nil, errors.New("at least one sample input is required")
+	} else if len(inputs) > maxEvalInputs {
+		return nil, nil, fmt.Errorf("at most %d sample inputs can be evaluated at once", maxEvalInputs)
+	}
+
+	for i := 0; i < len(inputs); i++ {
+		if len(inputs[i]) > maxEvalInputLength {
+			return nil, nil, fmt.Errorf("sample input %d exceeds %d characters", i+1, maxEvalInputLength)
+		}
+	}
+
+	if !contains(evalModels, r.Model) {
+		return nil, nil, fmt.Errorf("unsupported model %s", r.Model)
+	}
+
+	assertions, err := parseAssertions(strings.Split(r.Assertions, "\n"))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	judge := r.Judge == "llm"
+	if !judge && len(assertions) == 0 {
+		return nil, nil, errors.New("enable the LLM judge or add at least one assertion")
+	}
+
+	evaluation := domain.Evaluation{
+		Id:             uuid.New().String(),
+		OptimizationId: op.Id,
+		SessionId:      sessionId,
+		Model:          r.Model,
+		Judge:          judge,
+		Assertions:     make([]string, len(assertions)),
+		State:          "running"}
+
+	for i := 0; i < len(assertions); i++ {
+		evaluation.Assertions[i] = assertions[i].String()
+	}
+
+	return &evaluation, inputs, nil
+}
+
+type EvaluationForm struct {
+	OptimizationId string
+	Inputs         string
+	Assertions     string
+	Model          string
+	Judge          string
+	Models         []string
+	Past           []domain.Evaluation
+	ErrMsg         string
+}
+
+// EvaluationSummary aggregates the cases of an evaluation. Scores are averages of the judge
+// scores, pass rates are shares of passed assertions.
+type EvaluationSummary struct {
+	Cases             int
+	OriginalScore     float64
+	OptimizedScore    float64
+	OriginalPassRate  float64
+	OptimizedPassRate float64
+	OriginalWins      int
+	OptimizedWins     int
+	Ties              int
+}
+
+type EvaluationView struct {
+	Evaluation domain.Evaluation
+	Cases      []domain.EvaluationCase
+	Summary    EvaluationSummary
+}
+
+func (v EvaluationView) Finished() bool {
+	return v.Evaluation.State != "running"
+}
+
+func summarize(evaluation domain.Evaluation, cases []domain.EvaluationCase) EvaluationSummary {
+	summary := EvaluationSummary{Cases: len(cases)}
+
+	if len(cases) == 0 {
+		return summary
+	}
+
+	for i := 0; i < len(cases); i++ {
+		summary.OriginalScore += cases[i].OriginalScore
+		summary.OptimizedScore += cases[i].OptimizedScore
+		summary.OriginalPassRate += float64(cases[i].OriginalPassed)
+		summary.OptimizedPassRate += float64(cases[i].OptimizedPassed)
+
+		switch cases[i].Winner {
+		case "original":
+			summary.OriginalWins++
+		case "optimized":
+			summary.OptimizedWins++
+		default:
+			summary.Ties++
+		}
+	}
+
+	summary.OriginalScore /= float64(len(cases))
+	summary.OptimizedScore /= float64(len(cases))
+
+	if checks := float64(len(cases) * len(evaluation.Assertions)); checks > 0 {
+		summary.OriginalPassRate /= checks
+		summary.OptimizedPassRate /= checks
+	}
+
+	return summary
+}
+
+// substituteVariables fills template variables with the values of the same name
+func substituteVariables(content string, values map[string]string) string {
+	variables := detectVariables(content)
+
+	for i := 0; i < len(variables); i++ {
+		if value, ok := values[variables[i].Name]; ok {
+			content = strings.ReplaceAll(content, variables[i].Token, value)
+		}
+	}
+
+	return content
+}
+
+// evalMessages builds the conversation a prompt is evaluated with. Sample inputs that are JSON
+// objects fill the template variables of the prompt, other inputs are sent as user message.
+func evalMessages(prompt string, input string) []domain.ChatMessage {
+	messages, ok := parseChatPrompt(prompt)
+	if !ok {
+		messages = []domain.ChatMessage{{Role: "system", Content: prompt}}
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal([]byte(input), &values); err == nil && len(detectVariables(prompt)) > 0 {
+		for i := 0; i < len(messages); i++ {
+			messages[i].Content = substituteVariables(messages[i].Content, values)
+		}
+
+		return messages
+	}
+
+	return append(messages, domain.ChatMessage{Role: "user", Content: input})
+}
+
+func complete(ctx context.Context, repo *Repo, proto CompletionProto) (string, error) {
+	completion, err := repo.OAIRepo.PostCompletion(ctx, proto)
+
+	if err != nil {
+		return "", err
+	} else if completion == nil || len(completion.Choices) == 0 {
+		return "", errors.New("completion without choices")
+	}
+
+	return completion.Choices[0].Message.Content, nil
+}
+
+type judgement struct {
+	ScoreA    float64 `json:"score_a"`
+	ScoreB    float64 `json:"score_b"`
+	Winner    string  `json:"winner"`
+	Reasoning string  `json:"reasoning"`
+}
+
+const judgeInstruct = `You are judging two outputs, A and B, that two versions of the same model instructions produced for the same input.
+Judge which output better fulfills the intent of the model instructions and the input, considering correctness, completeness, format and tone.
+Answer with a JSON object with the fields 'score_a' and 'score_b' between 1 and 10, 'winner' being either "A", "B" or "tie" and a short 'reasoning'.`
+
+// judgeOutputs lets a model compare both outputs. The outputs are presented in random order so the
+// position doesn't favor one of the prompts.
+func judgeOutputs(ctx context.Context, repo *Repo, model string, prompt string, input string, original string, optimized string) (*judgement, error) {
+	swapped := rand.Intn(2) == 1
+	a, b := original, optimized
+	if swapped {
+		a, b = optimized, original
+	}
+
+	content := fmt.Sprintf("Model Instructions:\n\n%s\n\nInput:\n\n%s\n\nOutput A:\n\n%s\n\nOutput B:\n\n%s", prompt, input, a, b)
+
+	answer, err := complete(ctx, repo, CompletionProto{
+		Model:          model,
+		Messages:       []domain.ChatMessage{{Role: "system", Content: judgeInstruct}, {Role: "user", Content: content}},
+		ResponseFormat: &CompletionFormat{Type: "json_object"}})
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := ReadJSON[judgement]([]byte(answer))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// scores and winner are mapped back so A refers to the original prompt
+	if swapped {
+		result.ScoreA, result.ScoreB = result.ScoreB, result.ScoreA
+		switch result.Winner {
+		case "A":
+			result.Winner = "B"
+		case "B":
+			result.Winner = "A"
+		}
+	}
+
+	return result, nil
+}
+
+func evaluateCase(ctx context.Context, repo *Repo, config *Config, evaluation domain.Evaluation, assertions []assertion, op domain.Optimization,
+	input string, position int) domain.EvaluationCase {
+	evalCase := domain.EvaluationCase{
+		Id:             uuid.New().String(),
+		EvaluationId:   evaluation.Id,
+		OptimizationId: op.Id,
+		Position:       position,
+		Input:          input,
+		Failures:       []string{},
+		Winner:         "tie"}
+
+	var err error
+	evalCase.OriginalOutput, err = complete(ctx, repo, CompletionProto{Model: evaluation.Model, Messages: evalMessages(op.OriginalPrompt, input),
+		MaxTokens: evalMaxTokens})
+
+	if err != nil {
+		logger(ctx).Error("Completing original prompt failed", "error", err)
+		evalCase.Reasoning = "The original prompt could not be run."
+		return evalCase
+	}
+
+	evalCase.OptimizedOutput, err = complete(ctx, repo, CompletionProto{Model: evaluation.Model, Messages: evalMessages(op.OptimizedPrompt, input),
+		MaxTokens: evalMaxTokens})
+
+	if err != nil {
+		logger(ctx).Error("Completing optimized prompt failed", "error", err)
+		evalCase.Reasoning = "The optimized prompt could not be run."
+		return evalCase
+	}
+
+	for i := 0; i < len(assertions); i++ {
+		if assertions[i].check(evalCase.OriginalOutput) {
+			evalCase.OriginalPassed++
+		} else {
+			evalCase.Failures = append(evalCase.Failures, fmt.Sprintf("original: %s", assertions[i]))
+		}
+
+		if assertions[i].check(evalCase.OptimizedOutput) {
+			evalCase.OptimizedPassed++
+		} else {
+			evalCase.Failures = append(evalCase.Failures, fmt.Sprintf("optimized: %s", assertions[i]))
+		}
+	}
+
+	if evalCase.OptimizedPassed > evalCase.OriginalPassed {
+		evalCase.Winner = "optimized"
+	} else if evalCase.OriginalPassed > evalCase.OptimizedPassed {
+		evalCase.Winner = "original"
+	}
+
+	if !evaluation.Judge {
+		return evalCase
+	}
+
+	result, err := judgeOutputs(ctx, repo, config.JudgeModel, op.OriginalPrompt, input, evalCase.OriginalOutput, evalCase.OptimizedOutput)
+
+	if err != nil {
+		logger(ctx).Error("Judging outputs failed", "error", err)
+		evalCase.Reasoning = "The judge could not compare the outputs."
+		return evalCase
+	}
+
+	evalCase.OriginalScore = result.ScoreA
+	evalCase.OptimizedScore = result.ScoreB
+	evalCase.Reasoning = result.Reasoning
+
+	switch result.Winner {
+	case "A":
+		evalCase.Winner = "original"
+	case "B":
+		evalCase.Winner = "optimized"
+	default:
+		evalCase.Winner = "tie"
+	}
+
+	return evalCase
+}
+
+// runEvaluation runs both prompts for every sample input and stores the compared cases
+func runEvaluation(ctx context.Context, repo *Repo, config *Config, evaluation domain.Evaluation, op domain.Optimization, inputs []string) {
+	ctx = withLog(ctx, "evaluation_id", evaluation.Id, "optimization_id", op.Id)
+	assertions, err := parseAssertions(evaluation.Assertions)
+
+	if err != nil {
+		logger(ctx).Error("Parsing assertions failed", "error", err)
+		return
+	}
+
+	cases := make([]domain.EvaluationCase, len(inputs))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, evalConcurrency)
+
+	for i := 0; i < len(inputs); i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(position int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			cases[position] = evaluateCase(ctx, repo, config, evaluation, assertions, op, inputs[position], position)
+		}(i)
+	}
+
+	wg.Wait()
+
+	state := "completed"
+	if err = repo.EvalCaseRepo.Insert(ctx, cases); err != nil {
+		logger(ctx).Error("Storing evaluation cases failed", "error", err)
+		state = "failed"
+	}
+
+	if err = repo.EvalRepo.Update(ctx, evaluation.Id, state); err != nil {
+		logger(ctx).Error("Updating evaluation state failed", "error", err)
+		return
+	}
+
+	logger(ctx).Info("Finished evaluation", "state", state, "inputs", len(inputs))
+}
+
+func readEvaluationView(ctx context.Context, repo *Repo, config *Config, evaluation domain.Evaluation) (*EvaluationView, error) {
+	view := EvaluationView{Evaluation: evaluation, Cases: []domain.EvaluationCase{}}
+
+	if !view.Finished() {
+		return &view, nil
+	}
+
+	cases, err := repo.EvalCaseRepo.Read(ctx, evaluation.Id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = restoreEvaluationCases(config, evaluation, *cases); err != nil {
+		return nil, err
+	}
+
+	view.Cases = *cases
+	view.Summary = summarize(evaluation, *cases)
+
+	return &view, nil
+}
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+const historyLimit = 50
+
+// HistoryEntry is a version of an optimization lineage. Depth is the distance to the root
+// version the lineage started with.
+type HistoryEntry struct {
+	Optimization domain.Optimization
+	Depth        int
+	Suggestions  int
+	Upvoted      int
+	Excluded     int
+}
+
+// readLineageTree returns every version that shares the root of the given optimization. A limit
+// of 0 reads the whole tree.
+func readLineageTree(ctx context.Context, repo opRepo, id string, limit int) (*[]domain.Optimization, error) {
+	ancestors, err := readLineage(ctx, repo, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readSubtree(ctx, repo, (*ancestors)[len(*ancestors)-1], limit)
+}
+
+// readSubtree returns the given optimization followed by every version regenerated from it, directly
+// or through other versions. A limit of 0 reads the whole subtree.
+func readSubtree(ctx context.Context, repo opRepo, root domain.Optimization, limit int) (*[]domain.Optimization, error) {
+	tree := []domain.Optimization{root}
+	visited := map[string]bool{root.Id: true}
+
+	parentIds := []string{root.Id}
+	for len(parentIds) > 0 && (limit == 0 || len(tree) < limit) {
+		children, err := repo.ReadMany(ctx, OpReadFilter{ParentIdCond: inCond(parentIds)})
+
+		if err != nil {
+			return nil, err
+		}
+
+		parentIds = nil
+		for i := 0; i < len(*children) && (limit == 0 || len(tree) < limit); i++ {
+			child := (*children)[i]
+			if visited[child.Id] {
+				continue
+			}
+
+			visited[child.Id] = true
+			tree = append(tree, child)
+			parentIds = append(parentIds, child.Id)
+		}
+	}
+
+	return &tree, nil
+}
+
+// buildHistory orders optimizations depth first, so every version is listed below the one it was
+// regenerated from. Most recent lineages come first, versions within a lineage are chronological.
+func buildHistory(ops []domain.Optimization, suggs []domain.Suggestion) []HistoryEntry {
+	byId := make(map[string]bool)
+	for i := 0; i < len(ops); i++ {
+		byId[ops[i].Id] = true
+	}
+
+	var roots []domain.Optimization
+	children := make(map[string][]domain.Optimization)
+	for i := 0; i < len(ops); i++ {
+		if ops[i].ParentId != "" && byId[ops[i].ParentId] {
+			children[ops[i].ParentId] = append(children[ops[i].ParentId], ops[i])
+		} else {
+			roots = append(roots, ops[i])
+		}
+	}
+
+	sort.SliceStable(roots, func(i, j int) bool {
+		return roots[i].CreatedAt > roots[j].CreatedAt
+	})
+
+	var entries []HistoryEntry
+
+	var walk func(op domain.Optimization, depth int)
+	walk = func(op domain.Optimization, depth int) {
+		entries = append(entries, HistoryEntry{Optimization: op, Depth: depth})
+
+		versions := children[op.Id]
+		sort.SliceStable(versions, func(i, j int) bool {
+			return versions[i].CreatedAt < versions[j].CreatedAt
+		})
+
+		for i := 0; i < len(versions); i++ {
+			walk(versions[i], depth+1)
+		}
+	}
+
+	for i := 0; i < len(roots); i++ {
+		walk(roots[i], 0)
+	}
+
+	counts := make(map[string]*HistoryEntry)
+	for i := 0; i < len(entries); i++ {
+		counts[entries[i].Optimization.Id] = &entries[i]
+	}
+
+	for i := 0; i < len(suggs); i++ {
+		entry, ok := counts[suggs[i].OptimizationId]
+		if !ok {
+			continue
+		}
+
+		entry.Suggestions++
+		switch suggs[i].UserFeedback {
+		case 1:
+			entry.Upvoted++
+		case -1:
+			entry.Excluded++
+		}
+	}
+
+	return entries
+}
+
+func readHistory(ctx context.Context, repo *Repo, config *Config, id string, sessionId string) ([]HistoryEntry, error) {
+	var ops *[]domain.Optimization
+	var err error
+
+	if id != "" {
+		if _, err = readOwnedOptimization(ctx, repo.OpRepo, id, sessionId); err != nil {
+			return nil, err
+		}
+
+		ops, err = readLineageTree(ctx, repo.OpRepo, id, historyLimit)
+
+		// versions regenerated by other sessions, e.g. from a shared ancestor, aren't listed
+		if err == nil {
+			owned := []domain.Optimization{}
+			for i := 0; i < len(*ops); i++ {
+				if ownsOptimization((*ops)[i], sessionId) {
+					owned = append(owned, (*ops)[i])
+				}
+			}
+			ops = &owned
+		}
+	} else {
+		ops, err = repo.OpRepo.ReadMany(ctx, OpReadFilter{SessionIdCond: fmt.Sprintf("eq.%s", sessionId), Limit: historyLimit})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(*ops) == 0 {
+		return []HistoryEntry{}, nil
+	}
+
+	suggs, err := repo.SuggRepo.Read(ctx, SuggReadFilter{OpIdCond: inCond(lineageIds(*ops))})
+
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := restoreOptimizations(config, *ops)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buildHistory(restored, *suggs), nil
+}
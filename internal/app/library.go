@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+const maxLibraryTags = 10
+
+type libraryPromptReq struct {
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	Tags            string `json:"tags"`
+	LibraryPromptId string `json:"library_prompt_id"`
+}
+
+func (r libraryPromptReq) validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+
+	return nil
+}
+
+// LibraryEntry is a library prompt with the number of optimizations linked to it
+type LibraryEntry struct {
+	Prompt   domain.LibraryPrompt
+	Versions int
+}
+
+type LibraryView struct {
+	Entries []LibraryEntry
+	Tags    []string
+	Tag     string
+}
+
+// LibraryDetail is a library prompt with its versions, most recent first
+type LibraryDetail struct {
+	Prompt   domain.LibraryPrompt
+	Versions []domain.Optimization
+}
+
+// LibraryForm either edits Prompt or, if OptimizationId is set, saves an optimization to a new or
+// one of the Existing library prompts
+type LibraryForm struct {
+	Prompt         domain.LibraryPrompt
+	OptimizationId string
+	Existing       []domain.LibraryPrompt
+	ErrMsg         string
+}
+
+// parseTags splits a comma separated list into lower case tags. Tags are restricted to letters,
+// numbers, dashes and underscores so they can be used in filter conditions as is.
+func parseTags(raw string) []string {
+	tags := []string{}
+
+	parts := strings.Split(raw, ",")
+	for i := 0; i < len(parts) && len(tags) < maxLibraryTags; i++ {
+		tag := strings.Join(strings.Fields(strings.ToLower(parts[i])), "-")
+		tag = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_' {
+				return r
+			}
+			return -1
+		}, tag)
+
+		if tag != "" && !contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+func readLibrary(ctx context.Context, repo *Repo, owner string, tag string) (*LibraryView, error) {
+	filter := LibReadFilter{OwnerCond: fmt.Sprintf("eq.%s", owner)}
+
+	prompts, err := repo.LibRepo.ReadMany(ctx, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	view := LibraryView{Tags: []string{}}
+	for i := 0; i < len(*prompts); i++ {
+		tags := (*prompts)[i].Tags
+		for j := 0; j < len(tags); j++ {
+			if !contains(view.Tags, tags[j]) {
+				view.Tags = append(view.Tags, tags[j])
+			}
+		}
+	}
+	sort.Strings(view.Tags)
+
+	if contains(view.Tags, tag) {
+		view.Tag = tag
+		filter.TagsCond = fmt.Sprintf("cs.{%s}", tag)
+
+		prompts, err = repo.LibRepo.ReadMany(ctx, filter)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(*prompts) == 0 {
+		return &view, nil
+	}
+
+	ids := make([]string, len(*prompts))
+	for i := 0; i < len(*prompts); i++ {
+		ids[i] = (*prompts)[i].Id
+	}
+
+	ops, err := repo.OpRepo.ReadMany(ctx, OpReadFilter{LibraryPromptIdCond: inCond(ids)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < len(*ops); i++ {
+		counts[(*ops)[i].LibraryPromptId]++
+	}
+
+	for i := 0; i < len(*prompts); i++ {
+		view.Entries = append(view.Entries, LibraryEntry{Prompt: (*prompts)[i], Versions: counts[(*prompts)[i].Id]})
+	}
+
+	return &view, nil
+}
+
+func readLibraryDetail(ctx context.Context, repo *Repo, config *Config, prompt domain.LibraryPrompt) (*LibraryDetail, error) {
+	ops, err := repo.OpRepo.ReadMany(ctx, OpReadFilter{LibraryPromptIdCond: fmt.Sprintf("eq.%s", prompt.Id)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := restoreOptimizations(config, *ops)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &LibraryDetail{Prompt: prompt, Versions: versions}, nil
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+const maxLineageDepth = 50
+
+// readLineage walks the parent chain of an optimization. The optimization itself comes first,
+// followed by its parent, grandparent and so on.
+func readLineage(ctx context.Context, repo opRepo, id string) (*[]domain.Optimization, error) {
+	var lineage []domain.Optimization
+
+	visited := make(map[string]bool)
+	for id != "" && !visited[id] && len(lineage) < maxLineageDepth {
+		op, err := repo.Read(ctx, id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		visited[id] = true
+		lineage = append(lineage, *op)
+		id = op.ParentId
+	}
+
+	return &lineage, nil
+}
+
+func lineageIds(lineage []domain.Optimization) []string {
+	ids := make([]string, len(lineage))
+
+	for i := 0; i < len(lineage); i++ {
+		ids[i] = lineage[i].Id
+	}
+
+	return ids
+}
+
+func inCond(ids []string) string {
+	return fmt.Sprintf("in.(%s)", strings.Join(ids, ","))
+}
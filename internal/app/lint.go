@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+	"github.com/felixbrock/prompt-grammarly/internal/lint"
+	"github.com/google/uuid"
+)
+
+// lintAnalyzer names the runs and suggestions of the built-in lint rules
+const lintAnalyzer = "lint"
+
+// lint checks the prompt against the enabled lint rules. It runs offline, so its suggestions are
+// available even if every assistant fails.
+func (c OptimizationController) lint(ctx context.Context, opId string, base optimizationBase) ([]domain.Suggestion, error) {
+	linter, err := lint.New(lint.ParseRuleList(c.Config.LintDisabledRules))
+
+	if err != nil {
+		return nil, err
+	}
+
+	runId := uuid.New().String()
+	err = c.Repo.RunRepo.Insert(ctx, domain.Run{
+		Id:             runId,
+		Type:           lintAnalyzer,
+		State:          "running",
+		OptimizationId: opId})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []lint.Finding
+	if len(base.Messages) > 0 {
+		contents := make([]string, len(base.Messages))
+		for i := 0; i < len(base.Messages); i++ {
+			contents[i] = base.Messages[i].Content
+		}
+		findings = linter.Run(contents...)
+	} else {
+		findings = linter.Run(base.Prompt)
+	}
+
+	suggestions := make([]domain.Suggestion, len(findings))
+	for i := 0; i < len(findings); i++ {
+		index := findings[i].Index
+		suggestions[i] = domain.Suggestion{
+			Id:             uuid.New().String(),
+			Suggestion:     findings[i].Suggestion,
+			Reasoning:      findings[i].Reasoning,
+			UserFeedback:   0,
+			Target:         findings[i].Target,
+			Severity:       normalizeSeverity(findings[i].Severity),
+			Impact:         normalizeImpact(float64(findings[i].Impact)),
+			Type:           lintAnalyzer,
+			Analyzers:      []string{lintAnalyzer},
+			RunId:          runId,
+			OptimizationId: opId,
+			MessageIndex:   base.messageIndex(&index),
+			RuleId:         findings[i].RuleId}
+	}
+
+	err = c.Repo.RunRepo.Update(ctx, runId, "completed")
+
+	if err != nil {
+		return nil, err
+	}
+
+	logger(ctx).Info("Found lint issues", "count", len(suggestions))
+
+	return suggestions, nil
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// requestIdHeader carries the id of a request in responses, an id sent by a proxy is kept
+const requestIdHeader = "X-Request-Id"
+
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type loggerKey struct{}
+
+// logger returns the logger of the request or background job the context belongs to. Its records
+// carry the ids the context was annotated with, e.g. of the request and optimization.
+func logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+
+	return slog.Default()
+}
+
+// withLog annotates the logger of the context with key value pairs
+func withLog(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger(ctx).With(args...))
+}
+
+func requestId(r *http.Request) string {
+	if id := r.Header.Get(requestIdHeader); validRequestId.MatchString(id) {
+		return id
+	}
+
+	return uuid.New().String()
+}
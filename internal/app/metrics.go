@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felixbrock/prompt-grammarly/internal/metrics"
+	"github.com/felixbrock/prompt-grammarly/internal/tracing"
+)
+
+var (
+	httpRequests = metrics.NewCounter("http_requests_total",
+		"HTTP requests by route, method and status code.", "route", "method", "code")
+	httpDuration = metrics.NewHistogram("http_request_duration_seconds",
+		"Duration of HTTP requests by route and method.", metrics.DefaultBuckets, "route", "method")
+	rateLimited = metrics.NewCounter("http_rate_limited_total",
+		"Requests rejected by the rate limiter by route.", "route")
+	optimizations = metrics.NewCounter("optimizations_total",
+		"Optimizations by final state.", "state")
+	optimizationDuration = metrics.NewHistogram("optimization_duration_seconds",
+		"Duration of optimizations from the first analyzer run to the stored optimized prompt.", metrics.SlowBuckets, "state")
+	analyzerRuns = metrics.NewCounter("analyzer_runs_total",
+		"Analyzer runs by analyzer and outcome, i.e. completed, failed, timed_out or unparseable.", "analyzer", "outcome")
+	analyzerDuration = metrics.NewHistogram("analyzer_run_duration_seconds",
+		"Duration of analyzer runs by analyzer and outcome.", metrics.SlowBuckets, "analyzer", "outcome")
+	feedbackEvents = metrics.NewCounter("feedback_events_total",
+		"Feedback on suggestions by value, i.e. upvote, exclude or reset.", "value")
+)
+
+type observationKey struct{}
+
+// observation carries the route of a request to the handlers, and the status code the
+// controller responded with back to the instrumentation
+type observation struct {
+	route string
+	code  int
+}
+
+func observe(ctx context.Context) *observation {
+	if o, ok := ctx.Value(observationKey{}).(*observation); ok {
+		return o
+	}
+
+	return &observation{}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// instrument traces every request, hands it a logger with its request id and records it with the
+// route pattern it matched, so the metrics don't grow with arbitrary paths. Controllers rewrite
+// error codes to 200 to render error components, the code they reported is recorded instead.
+func instrument(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx, span := tracing.StartServer(r.Context(), fmt.Sprintf("%s %s", r.Method, route), r.Header.Get("traceparent"),
+			tracing.String("http.method", r.Method), tracing.String("http.route", route))
+		defer span.End()
+
+		id := requestId(r)
+		w.Header().Set(requestIdHeader, id)
+		span.SetAttributes(tracing.String("request.id", id))
+
+		ctx = withLog(ctx, "request_id", id, "method", r.Method, "route", route)
+		if traceId := span.TraceId(); traceId != "" {
+			ctx = withLog(ctx, "trace_id", traceId)
+		}
+
+		o := &observation{route: route}
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(ctx, observationKey{}, o)))
+
+		code := recorder.code
+		if o.code != 0 && code == http.StatusOK {
+			code = o.code
+		}
+
+		span.SetAttributes(tracing.Int("http.status_code", code))
+		if code >= http.StatusInternalServerError {
+			span.RecordError(fmt.Errorf("responded with status %d", code))
+		}
+
+		httpRequests.Inc(route, r.Method, strconv.Itoa(code))
+		httpDuration.Observe(time.Since(start).Seconds(), route, r.Method)
+	})
+}
+
+// metricAnalyzer keeps user defined analyzers from adding a label value each
+func metricAnalyzer(name string) string {
+	if _, ok := findAnalyzer(name); ok || name == lintAnalyzer {
+		return name
+	}
+
+	return "custom_analyzer"
+}
+
+func feedbackValue(value int16) string {
+	switch value {
+	case 1:
+		return "upvote"
+	case -1:
+		return "exclude"
+	default:
+		return "reset"
+	}
+}
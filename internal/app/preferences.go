@@ -0,0 +1,213 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+const (
+	profileEventLimit   = 200
+	profilePatternLimit = 3
+)
+
+// PreferencePattern is a group of similar suggestions that received the same feedback
+type PreferencePattern struct {
+	Example string
+	Count   int
+	Reasons []string
+}
+
+type DimensionPreference struct {
+	Dimension string
+	Upvoted   int
+	Excluded  int
+	Prefer    []PreferencePattern
+	Avoid     []PreferencePattern
+}
+
+// PreferenceProfile summarizes the feedback a session has given since its last reset
+type PreferenceProfile struct {
+	SessionId  string
+	ResetAt    string
+	Dimensions []DimensionPreference
+}
+
+func (p PreferenceProfile) Empty() bool {
+	return len(p.Dimensions) == 0
+}
+
+func (p PreferenceProfile) dimension(name string) *DimensionPreference {
+	for i := 0; i < len(p.Dimensions); i++ {
+		if p.Dimensions[i].Dimension == name {
+			return &p.Dimensions[i]
+		}
+	}
+
+	return nil
+}
+
+func addToPatterns(patterns []PreferencePattern, sugg domain.Suggestion, reason string) []PreferencePattern {
+	for i := 0; i < len(patterns); i++ {
+		if similarity(patterns[i].Example, sugg.Suggestion) < similarityThreshold {
+			continue
+		}
+
+		patterns[i].Count++
+		if reason != "" && !contains(patterns[i].Reasons, reason) {
+			patterns[i].Reasons = append(patterns[i].Reasons, reason)
+		}
+
+		return patterns
+	}
+
+	pattern := PreferencePattern{Example: sugg.Suggestion, Count: 1}
+	if reason != "" {
+		pattern.Reasons = []string{reason}
+	}
+
+	return append(patterns, pattern)
+}
+
+func topPatterns(patterns []PreferencePattern) []PreferencePattern {
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return patterns[i].Count > patterns[j].Count
+	})
+
+	if len(patterns) > profilePatternLimit {
+		return patterns[:profilePatternLimit]
+	}
+
+	return patterns
+}
+
+// readPreferenceProfile aggregates the latest feedback per suggestion of a session by
+// dimension and groups similar suggestions into patterns
+func readPreferenceProfile(ctx context.Context, repo *Repo, sessionId string) (*PreferenceProfile, error) {
+	profile := PreferenceProfile{SessionId: sessionId}
+
+	record, err := repo.ProfRepo.Read(ctx, sessionId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	filter := FeedbReadFilter{SessionIdCond: fmt.Sprintf("eq.%s", sessionId), Limit: profileEventLimit}
+	if record != nil && record.ResetAt != "" {
+		resetAt, err := time.Parse(time.RFC3339Nano, record.ResetAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the backend returns offsets like +00:00, whose plus sign would be decoded as a space in the query
+		profile.ResetAt = record.ResetAt
+		filter.CreatedAtCond = fmt.Sprintf("gt.%s", resetAt.UTC().Format(time.RFC3339Nano))
+	}
+
+	events, err := repo.FeedbRepo.Read(ctx, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// events are ordered from newest to oldest, so the first event of a suggestion is its current state
+	latest := make(map[string]domain.FeedbackEvent)
+	var ids []string
+	for i := 0; i < len(*events); i++ {
+		event := (*events)[i]
+		if _, ok := latest[event.SuggestionId]; ok {
+			continue
+		}
+
+		latest[event.SuggestionId] = event
+		if event.Value != 0 {
+			ids = append(ids, event.SuggestionId)
+		}
+	}
+
+	if len(ids) == 0 {
+		return &profile, nil
+	}
+
+	suggs, err := repo.SuggRepo.Read(ctx, SuggReadFilter{IdCond: inCond(ids)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	byDimension := make(map[string]*DimensionPreference)
+	var names []string
+	for i := 0; i < len(*suggs); i++ {
+		sugg := (*suggs)[i]
+		event := latest[sugg.Id]
+
+		pref, ok := byDimension[sugg.Type]
+		if !ok {
+			pref = &DimensionPreference{Dimension: sugg.Type}
+			byDimension[sugg.Type] = pref
+			names = append(names, sugg.Type)
+		}
+
+		if event.Value > 0 {
+			pref.Upvoted++
+			pref.Prefer = addToPatterns(pref.Prefer, sugg, "")
+		} else {
+			pref.Excluded++
+			pref.Avoid = addToPatterns(pref.Avoid, sugg, event.Reason)
+		}
+	}
+
+	sort.Strings(names)
+	for i := 0; i < len(names); i++ {
+		pref := byDimension[names[i]]
+		pref.Prefer = topPatterns(pref.Prefer)
+		pref.Avoid = topPatterns(pref.Avoid)
+		profile.Dimensions = append(profile.Dimensions, *pref)
+	}
+
+	return &profile, nil
+}
+
+// preferenceCtx describes the learned preferences of a dimension to the analyzer
+func (p PreferenceProfile) preferenceCtx(dimension string) string {
+	pref := p.dimension(dimension)
+
+	if pref == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf(`User Preferences:
+
+			In previous optimizations the user excluded %d and upvoted %d of your suggestions.
+			`, pref.Excluded, pref.Upvoted))
+
+	if len(pref.Avoid) > 0 {
+		b.WriteString(`Avoid suggestions similar to the following ones, the user rejected them repeatedly:
+			`)
+		for i := 0; i < len(pref.Avoid); i++ {
+			b.WriteString(fmt.Sprintf(`- "%s" (rejected %d times`, pref.Avoid[i].Example, pref.Avoid[i].Count))
+			if len(pref.Avoid[i].Reasons) > 0 {
+				b.WriteString(fmt.Sprintf(`, reasons: %s`, strings.Join(pref.Avoid[i].Reasons, "; ")))
+			}
+			b.WriteString(`)
+			`)
+		}
+	}
+
+	if len(pref.Prefer) > 0 {
+		b.WriteString(`Prefer suggestions similar to the following ones, the user liked them:
+			`)
+		for i := 0; i < len(pref.Prefer); i++ {
+			b.WriteString(fmt.Sprintf(`- "%s" (liked %d times)
+			`, pref.Prefer[i].Example, pref.Prefer[i].Count))
+		}
+	}
+
+	return b.String()
+}
@@ -2,7 +2,6 @@ package app
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
 	"log/slog"
 )
@@ -13,7 +12,7 @@ func Read(reader io.ReadCloser) ([]byte, error) {
 	defer func() {
 		err = (reader).Close()
 		if err != nil {
-			slog.Error(fmt.Sprintf("Error occured: %s", err.Error()))
+			slog.Error("Closing reader failed", "error", err)
 		}
 	}()
 
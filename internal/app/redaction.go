@@ -0,0 +1,248 @@
+package app
+
+import (
+	"errors"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+	"github.com/felixbrock/prompt-grammarly/internal/redact"
+)
+
+// redactText redacts the content of every message of chat prompts, so the JSON structure stays valid
+func redactText(redactor *redact.Redactor, text string, m redact.Map) (string, error) {
+	messages, ok := parseChatPrompt(text)
+	if !ok {
+		return redactor.Redact(text, m), nil
+	}
+
+	for i := 0; i < len(messages); i++ {
+		messages[i].Content = redactor.Redact(messages[i].Content, m)
+	}
+
+	return formatChatPrompt(messages)
+}
+
+func restoreText(text string, m redact.Map) (string, error) {
+	messages, ok := parseChatPrompt(text)
+	if !ok {
+		return m.Restore(text), nil
+	}
+
+	for i := 0; i < len(messages); i++ {
+		messages[i].Content = m.Restore(messages[i].Content)
+	}
+
+	return formatChatPrompt(messages)
+}
+
+// redaction redacts texts that belong to one optimization with the same placeholder map, so
+// values keep their placeholders across the prompt, its versions, evaluations and analyzers
+type redaction struct {
+	redactor *redact.Redactor
+	key      []byte
+	m        redact.Map
+}
+
+var errNoRedactionKey = errors.New("no redaction key configured")
+
+// openRedaction extends the sealed map of an optimization, e.g. of its parent. Redaction requires
+// a key, as values that can't be restored would be lost for the owner.
+func openRedaction(config *Config, sealed string) (*redaction, error) {
+	if config.RedactionKey == "" {
+		return nil, errNoRedactionKey
+	}
+
+	patterns, err := redact.ParsePatterns(config.RedactionPatterns)
+
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := redact.New(patterns)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := redact.ParseKey(config.RedactionKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := redact.Open(key, sealed)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &redaction{redactor: redactor, key: key, m: m}, nil
+}
+
+func (r *redaction) text(text string) (string, error) {
+	return redactText(r.redactor, text, r.m)
+}
+
+func (r *redaction) seal() (string, error) {
+	return redact.Seal(r.key, r.m)
+}
+
+// redactOptimization replaces secrets and personal data of the prompt, the instructions and the
+// instructions of the selected custom analyzers with placeholders before the optimization is
+// stored or sent to a model. The map of placeholders is sealed with the redaction key. The
+// custom analyzers are only redacted for the model, their stored definitions are unchanged.
+// Nothing is redacted if redaction is disabled.
+func redactOptimization(config *Config, op domain.Optimization, custom []domain.CustomAnalyzer) (domain.Optimization, []domain.CustomAnalyzer, error) {
+	if config.RedactionDisabled {
+		return op, custom, nil
+	}
+
+	r, err := openRedaction(config, op.Redactions)
+
+	if err != nil {
+		return op, custom, err
+	}
+
+	if op.OriginalPrompt, err = r.text(op.OriginalPrompt); err != nil {
+		return op, custom, err
+	}
+	op.Instructions = r.redactor.Redact(op.Instructions, r.m)
+
+	redacted := make([]domain.CustomAnalyzer, len(custom))
+	for i := 0; i < len(custom); i++ {
+		redacted[i] = custom[i]
+		redacted[i].Instructions = r.redactor.Redact(custom[i].Instructions, r.m)
+	}
+
+	op.Redactions, err = r.seal()
+
+	return op, redacted, err
+}
+
+// redactEvaluation redacts the sample inputs with the placeholders of the optimization before they
+// are stored or sent to a model
+func redactEvaluation(config *Config, op domain.Optimization, evaluation domain.Evaluation, inputs []string) (domain.Evaluation, []string, error) {
+	if config.RedactionDisabled {
+		return evaluation, inputs, nil
+	}
+
+	r, err := openRedaction(config, op.Redactions)
+
+	if err != nil {
+		return evaluation, inputs, err
+	}
+
+	redacted := make([]string, len(inputs))
+	for i := 0; i < len(inputs); i++ {
+		redacted[i] = r.redactor.Redact(inputs[i], r.m)
+	}
+
+	evaluation.Redactions, err = r.seal()
+
+	return evaluation, redacted, err
+}
+
+// redactReason redacts the free text reason of a feedback event before it is stored, as reasons
+// are added to later analyzer prompts. Values of the optimization keep their placeholders, the
+// map isn't stored again as reasons aren't restored.
+func redactReason(config *Config, op domain.Optimization, reason string) (string, error) {
+	if config.RedactionDisabled || reason == "" {
+		return reason, nil
+	}
+
+	r, err := openRedaction(config, op.Redactions)
+
+	if err != nil {
+		return reason, err
+	}
+
+	return r.redactor.Redact(reason, r.m), nil
+}
+
+// readRedactions opens a sealed map of placeholders. Without a key nothing was redacted, as
+// redaction is disabled then.
+func readRedactions(config *Config, sealed string) (redact.Map, error) {
+	if sealed == "" || config.RedactionKey == "" {
+		return redact.Map{}, nil
+	}
+
+	key, err := redact.ParseKey(config.RedactionKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return redact.Open(key, sealed)
+}
+
+// restoreOptimization puts the redacted values back into the prompts shown to the owner of the
+// optimization. The result is only meant for output, so the sealed map is dropped from it.
+func restoreOptimization(config *Config, op domain.Optimization) (domain.Optimization, error) {
+	m, err := readRedactions(config, op.Redactions)
+
+	if err != nil {
+		return op, err
+	}
+
+	op.Redactions = ""
+	if op.OriginalPrompt, err = restoreText(op.OriginalPrompt, m); err != nil {
+		return op, err
+	}
+	if op.OptimizedPrompt, err = restoreText(op.OptimizedPrompt, m); err != nil {
+		return op, err
+	}
+	op.Instructions = m.Restore(op.Instructions)
+
+	return op, nil
+}
+
+func restoreOptimizations(config *Config, ops []domain.Optimization) ([]domain.Optimization, error) {
+	restored := make([]domain.Optimization, len(ops))
+
+	for i := 0; i < len(ops); i++ {
+		op, err := restoreOptimization(config, ops[i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		restored[i] = op
+	}
+
+	return restored, nil
+}
+
+// restoreSuggestions puts the redacted values back into the suggestions of an optimization, so
+// their targets match the restored prompt
+func restoreSuggestions(config *Config, op domain.Optimization, suggs []domain.Suggestion) error {
+	m, err := readRedactions(config, op.Redactions)
+
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(suggs); i++ {
+		suggs[i].Suggestion = m.Restore(suggs[i].Suggestion)
+		suggs[i].Reasoning = m.Restore(suggs[i].Reasoning)
+		suggs[i].Target = m.Restore(suggs[i].Target)
+	}
+
+	return nil
+}
+
+// restoreEvaluationCases puts the redacted values back into the sample inputs and outputs
+func restoreEvaluationCases(config *Config, evaluation domain.Evaluation, cases []domain.EvaluationCase) error {
+	m, err := readRedactions(config, evaluation.Redactions)
+
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(cases); i++ {
+		cases[i].Input = m.Restore(cases[i].Input)
+		cases[i].OriginalOutput = m.Restore(cases[i].OriginalOutput)
+		cases[i].OptimizedOutput = m.Restore(cases[i].OptimizedOutput)
+		cases[i].Reasoning = m.Restore(cases[i].Reasoning)
+	}
+
+	return nil
+}
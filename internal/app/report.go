@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+type ReportSuggestion struct {
+	domain.Suggestion
+	Feedback string `json:"feedback"`
+}
+
+// Report bundles everything that is known about an optimization for exporting it
+type Report struct {
+	Optimization domain.Optimization   `json:"optimization"`
+	Suggestions  []ReportSuggestion    `json:"suggestions"`
+	Lineage      []domain.Optimization `json:"lineage"`
+	// Labels are the names users gave their custom analyzers, by analyzer name
+	Labels map[string]string `json:"-"`
+}
+
+func (r Report) label(analyzer string) string {
+	if label, ok := r.Labels[analyzer]; ok {
+		return label
+	}
+
+	return analyzer
+}
+
+// rawComponent renders content that isn't built from templ components, e.g. file downloads
+type rawComponent []byte
+
+func (c rawComponent) Render(ctx context.Context, w io.Writer) error {
+	_, err := w.Write(c)
+	return err
+}
+
+func feedbackState(userFeedback int16) string {
+	switch userFeedback {
+	case 1:
+		return "upvoted"
+	case -1:
+		return "excluded"
+	default:
+		return "none"
+	}
+}
+
+// readReport restores the redacted values, reports are only exported for the owner of the optimization
+func readReport(ctx context.Context, repo *Repo, config *Config, op domain.Optimization) (*Report, error) {
+	suggs, err := repo.SuggRepo.Read(ctx, SuggReadFilter{OpIdCond: fmt.Sprintf("eq.%s", op.Id)})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = restoreSuggestions(config, op, *suggs); err != nil {
+		return nil, err
+	}
+
+	SuggView{Sort: "severity"}.sort(*suggs)
+
+	lineage, err := readLineage(ctx, repo.OpRepo, op.ParentId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the lineage starts with the exported version itself
+	versions, err := restoreOptimizations(config, append([]domain.Optimization{op}, *lineage...))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if op, err = restoreOptimization(config, op); err != nil {
+		return nil, err
+	}
+
+	custom, err := readCustomAnalyzers(ctx, repo, op.Analyzers)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := Report{Optimization: op, Suggestions: make([]ReportSuggestion, len(*suggs)), Lineage: versions,
+		Labels: analyzerLabels(custom)}
+	for i := 0; i < len(*suggs); i++ {
+		report.Suggestions[i] = ReportSuggestion{Suggestion: (*suggs)[i], Feedback: feedbackState((*suggs)[i].UserFeedback)}
+	}
+
+	return &report, nil
+}
+
+func (r Report) json() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+func writeMarkdownBlock(b *strings.Builder, title string, text string) {
+	b.WriteString(fmt.Sprintf("## %s\n\n", title))
+	b.WriteString(fmt.Sprintf("````\n%s\n````\n\n", text))
+}
+
+func (r Report) markdown() []byte {
+	var b strings.Builder
+
+	op := r.Optimization
+	b.WriteString("# Prompt Optimization Report\n\n")
+	b.WriteString(fmt.Sprintf("- Id: `%s`\n", op.Id))
+	if op.CreatedAt != "" {
+		b.WriteString(fmt.Sprintf("- Created: %s\n", op.CreatedAt))
+	}
+	b.WriteString(fmt.Sprintf("- State: %s\n\n", op.State))
+
+	if op.Instructions != "" {
+		writeMarkdownBlock(&b, "Instructions", op.Instructions)
+	}
+	writeMarkdownBlock(&b, "Original Prompt", op.OriginalPrompt)
+	writeMarkdownBlock(&b, "Optimized Prompt", op.OptimizedPrompt)
+
+	b.WriteString(fmt.Sprintf("## Suggestions (%d)\n\n", len(r.Suggestions)))
+	for i := 0; i < len(r.Suggestions); i++ {
+		sugg := r.Suggestions[i]
+		b.WriteString(fmt.Sprintf("### %d. %s (%s, impact %d/10)\n\n", i+1, r.label(sugg.Type), sugg.Severity, sugg.Impact))
+		b.WriteString(fmt.Sprintf("%s\n\n", sugg.Suggestion.Suggestion))
+		b.WriteString(fmt.Sprintf("- Reasoning: %s\n", sugg.Reasoning))
+		b.WriteString(fmt.Sprintf("- Target: %s\n", sugg.Target))
+		if len(sugg.Analyzers) > 1 {
+			labels := make([]string, len(sugg.Analyzers))
+			for j := 0; j < len(sugg.Analyzers); j++ {
+				labels[j] = r.label(sugg.Analyzers[j])
+			}
+			b.WriteString(fmt.Sprintf("- Agreed by: %s\n", strings.Join(labels, ", ")))
+		}
+		b.WriteString(fmt.Sprintf("- Feedback: %s\n\n", sugg.Feedback))
+	}
+
+	if len(r.Lineage) > 0 {
+		b.WriteString("## Lineage\n\n")
+		b.WriteString("| Version | Id | Created | Instructions |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		for i := 0; i < len(r.Lineage); i++ {
+			version := r.Lineage[i]
+			instructions := strings.ReplaceAll(strings.ReplaceAll(version.Instructions, "\n", " "), "|", "\\|")
+			b.WriteString(fmt.Sprintf("| %d | `%s` | %s | %s |\n", len(r.Lineage)-i, version.Id, version.CreatedAt, instructions))
+		}
+		b.WriteString("\n")
+	}
+
+	return []byte(b.String())
+}
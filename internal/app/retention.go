@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	retentionSweepInterval = time.Hour
+	purgeChunkSize         = 100
+)
+
+// PurgeReport counts the records removed by a purge
+type PurgeReport struct {
+	Optimizations int
+	Suggestions   int
+	Runs          int
+	Feedback      int
+	Shares        int
+	Evaluations   int
+	AutoRuns      int
+}
+
+func (p *PurgeReport) add(other PurgeReport) {
+	p.Optimizations += other.Optimizations
+	p.Suggestions += other.Suggestions
+	p.Runs += other.Runs
+	p.Feedback += other.Feedback
+	p.Shares += other.Shares
+	p.Evaluations += other.Evaluations
+	p.AutoRuns += other.AutoRuns
+}
+
+func (p PurgeReport) String() string {
+	return fmt.Sprintf("%d optimizations, %d suggestions, %d runs, %d feedback events, %d shares, %d evaluations and %d auto runs",
+		p.Optimizations, p.Suggestions, p.Runs, p.Feedback, p.Shares, p.Evaluations, p.AutoRuns)
+}
+
+func purgeChunk(ctx context.Context, repo *Repo, ids []string) (*PurgeReport, error) {
+	var report PurgeReport
+	var err error
+	cond := inCond(ids)
+
+	// versions regenerated from a purged optimization are kept and become roots of their own lineage
+	if err = repo.OpRepo.Detach(ctx, cond); err != nil {
+		return nil, err
+	}
+
+	if report.Feedback, err = repo.FeedbRepo.Delete(ctx, cond); err != nil {
+		return nil, err
+	}
+	if report.Shares, err = repo.ShareRepo.Delete(ctx, cond); err != nil {
+		return nil, err
+	}
+	if _, err = repo.EvalCaseRepo.Delete(ctx, cond); err != nil {
+		return nil, err
+	}
+	if report.Evaluations, err = repo.EvalRepo.Delete(ctx, cond); err != nil {
+		return nil, err
+	}
+	if report.AutoRuns, err = repo.AutoRunRepo.Delete(ctx, cond); err != nil {
+		return nil, err
+	}
+	if report.Suggestions, err = repo.SuggRepo.Delete(ctx, cond); err != nil {
+		return nil, err
+	}
+	if report.Runs, err = repo.RunRepo.Delete(ctx, cond); err != nil {
+		return nil, err
+	}
+	if report.Optimizations, err = repo.OpRepo.Delete(ctx, cond); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// purge hard deletes optimizations together with their runs, suggestions, feedback and shares
+func purge(ctx context.Context, repo *Repo, ids []string) (*PurgeReport, error) {
+	var report PurgeReport
+
+	for start := 0; start < len(ids); start += purgeChunkSize {
+		end := start + purgeChunkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		chunk, err := purgeChunk(ctx, repo, ids[start:end])
+
+		if err != nil {
+			return nil, err
+		}
+
+		report.add(*chunk)
+	}
+
+	return &report, nil
+}
+
+// enforceRetention purges every optimization created before the retention period
+func enforceRetention(ctx context.Context, repo *Repo, retentionDays int) (*PurgeReport, error) {
+	var report PurgeReport
+	cutoff := time.Now().UTC().AddDate(0, 0, -retentionDays).Format(time.RFC3339)
+
+	for {
+		ops, err := repo.OpRepo.ReadMany(ctx, OpReadFilter{CreatedAtConds: []string{fmt.Sprintf("lt.%s", cutoff)}, Limit: purgeChunkSize})
+
+		if err != nil {
+			return &report, err
+		}
+
+		if len(*ops) == 0 {
+			return &report, nil
+		}
+
+		chunk, err := purge(ctx, repo, lineageIds(*ops))
+
+		if err != nil {
+			return &report, err
+		}
+
+		report.add(*chunk)
+
+		// stops if the expired optimizations could not be removed, instead of reading them again
+		if chunk.Optimizations == 0 {
+			return &report, nil
+		}
+	}
+}
+
+// sweepRetention enforces the retention period until ctx is done
+func (a App) sweepRetention(ctx context.Context) {
+	if a.Config.RetentionDays <= 0 {
+		logger(ctx).Info("Retention sweeper disabled, optimizations are kept indefinitely")
+		return
+	}
+
+	ticker := time.NewTicker(retentionSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		report, err := enforceRetention(ctx, &a.Repo, a.Config.RetentionDays)
+
+		if err != nil {
+			logger(ctx).Error("Retention sweep failed", "error", err)
+		}
+
+		if report.Optimizations > 0 {
+			logger(ctx).Info("Retention sweep removed expired optimizations", "removed", report.String(),
+				"retention_days", a.Config.RetentionDays)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
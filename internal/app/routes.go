@@ -5,14 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log/slog"
 	"net/http"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/felixbrock/prompt-grammarly/internal/domain"
+	"github.com/felixbrock/prompt-grammarly/internal/tracing"
 	"github.com/google/uuid"
 )
 
@@ -28,22 +30,47 @@ type OAIThread struct {
 type assistant struct {
 	Id   string
 	Name string
+	// Instructions are the evaluation instructions of custom analyzers
+	Instructions string
 }
 
+var analyzers = []assistant{{Id: "asst_BxUQqxSD8tcvQoyR6T5iom3L", Name: "contextual_richness"},
+	{Id: "asst_3q6LvmiPZyoPChdrcuqMxOvh", Name: "conciseness"},
+	{Id: "asst_8IjCbTm7tsgCtSbhEL7E7rjB", Name: "clarity"},
+	{Id: "asst_221Q0E9EeazCHcGV4Qd050Gy", Name: "consistency"},
+	{Id: "asst_9zcQxyRh4E10Agg08p8mYDO8", Name: "custom"},
+	{Id: customAssistantId, Name: securityAnalyzer, Instructions: securityInstruct}}
+
 type optimizationReq struct {
-	OriginalPrompt string `json:"prompt"`
-	Instructions   string `json:"instructions"`
+	OriginalPrompt string               `json:"prompt"`
+	Messages       []domain.ChatMessage `json:"messages"`
+	Instructions   string               `json:"instructions"`
+	MaxTokens      formNumber           `json:"max_tokens"`
+	Analyzers      formList             `json:"analyzers"`
 }
 
+// oaiSuggestion is a suggestion of an analyzer. Impact is a formNumber, as models sometimes
+// return fractions or strings.
 type oaiSuggestion struct {
-	Suggestion string `json:"new"`
-	Reasoning  string `json:"reasoning"`
-	Target     string `json:"original"`
+	Suggestion   string     `json:"new"`
+	Reasoning    string     `json:"reasoning"`
+	Target       string     `json:"original"`
+	Severity     string     `json:"severity"`
+	Impact       formNumber `json:"impact"`
+	MessageIndex *int       `json:"message_index,omitempty"`
+}
+
+type OAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 type OAIRun struct {
 	Id     string `json:"id"`
 	Status string `json:"status"`
+	// Usage is only set for completed runs
+	Usage *OAIUsage `json:"usage"`
 }
 
 type messageContentText struct {
@@ -63,56 +90,106 @@ type OAIMessageListing struct {
 	Data []OAIMessage `json:"data"`
 }
 
+type CompletionFormat struct {
+	Type string `json:"type"`
+}
+
+type CompletionProto struct {
+	Model          string               `json:"model"`
+	Messages       []domain.ChatMessage `json:"messages"`
+	MaxTokens      int                  `json:"max_tokens,omitempty"`
+	ResponseFormat *CompletionFormat    `json:"response_format,omitempty"`
+}
+
+type OAIChoice struct {
+	Message domain.ChatMessage `json:"message"`
+}
+
+type OAICompletion struct {
+	Choices []OAIChoice `json:"choices"`
+}
+
 type AnalysisState struct {
 	CustomCompleted             bool
 	ContextualRichnessCompleted bool
 	ConcisenessCompleted        bool
 	ClarityCompleted            bool
 	ConsistencyCompleted        bool
+	LintCompleted               bool
+	SecurityCompleted           bool
+	Custom                      []AnalyzerProgress
+	securityRun                 bool
 }
 
+// Completed doesn't await the lint rules, as they finish before the assistants start and weren't
+// run for optimizations created before they existed. The same goes for the security analyzer.
 func (s AnalysisState) Completed() bool {
+	for i := 0; i < len(s.Custom); i++ {
+		if !s.Custom[i].Completed {
+			return false
+		}
+	}
+
+	if s.securityRun && !s.SecurityCompleted {
+		return false
+	}
+
 	return s.CustomCompleted && s.ContextualRichnessCompleted && s.ConcisenessCompleted && s.ClarityCompleted && s.ConsistencyCompleted
 }
 
-func (c OptimizationController) runAssistant(threadId string, userPrompt string, assistant assistant) ([]byte, error) {
-	err := c.writeUserPrompt(threadId, userPrompt)
+func (c OptimizationController) runAssistant(ctx context.Context, threadId string, userPrompt string, assistant assistant, usage *usageMeter) (bMsg []byte, err error) {
+	ctx, span := tracing.Start(ctx, "runAssistant", tracing.String("analyzer", assistant.Name), tracing.String("thread.id", threadId))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	ctx = withLog(ctx, "thread_id", threadId)
+
+	err = c.writeUserPrompt(ctx, threadId, userPrompt)
 
 	if err != nil {
 		return nil, err
 	}
 
-	entity, err := c.Repo.OAIRepo.PostRun(assistant.Id, threadId)
+	entity, err := c.Repo.OAIRepo.PostRun(ctx, assistant.Id, threadId)
 
 	if err != nil {
 		return nil, err
 	}
+	span.SetAttributes(tracing.String("run.id", entity.Id))
+	ctx = withLog(ctx, "assistant_run_id", entity.Id)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	pollCtx, cancel := context.WithTimeout(ctx, 120*time.Second)
 	defer cancel()
 
-	slog.Info(fmt.Sprintf("Running %s analysis...\n", assistant.Name))
+	logger(ctx).Info("Running analysis")
+	polls := 0
 	completed := false
 	for !completed {
 		select {
-		case <-ctx.Done():
-			slog.Warn(fmt.Sprintf("Assistant %s run timed out. Ignoring run...", assistant.Name))
+		case <-pollCtx.Done():
+			logger(ctx).Warn("Assistant run timed out, ignoring run", "polls", polls)
+			span.SetAttributes(tracing.Int("polls", polls), tracing.Bool("timed_out", true))
 			return make([]byte, 0), nil
 		default:
-			entity, err = c.Repo.OAIRepo.GetRun(threadId, entity.Id)
+			polls++
+			entity, err = c.Repo.OAIRepo.GetRun(ctx, threadId, entity.Id)
 
 			if err != nil {
 				return nil, err
 			} else if entity.Status == "completed" {
 				completed = true
+				usage.add(entity.Usage)
 			}
 
 			time.Sleep(time.Second)
 		}
 	}
+	span.SetAttributes(tracing.Int("polls", polls))
 
 	var msgs *[]OAIMessage
-	msgs, err = c.Repo.OAIRepo.GetMsgs(threadId)
+	msgs, err = c.Repo.OAIRepo.GetMsgs(ctx, threadId)
 
 	if err != nil {
 		return nil, err
@@ -126,18 +203,18 @@ func (c OptimizationController) runAssistant(threadId string, userPrompt string,
 		return nil, errors.New("unexpected assistant response error")
 	}
 
-	bMsg := []byte(msg.Content[0].Text.Value)
+	bMsg = []byte(msg.Content[0].Text.Value)
 	return bMsg, nil
 }
 
-func (c OptimizationController) writeUserPrompt(threadId string, prompt string) error {
+func (c OptimizationController) writeUserPrompt(ctx context.Context, threadId string, prompt string) error {
 	msgContent, err := json.Marshal(prompt)
 
 	if err != nil {
 		return err
 	}
 
-	err = c.Repo.OAIRepo.PostMsg(MessageProto{Role: "user", Content: msgContent}, threadId)
+	err = c.Repo.OAIRepo.PostMsg(ctx, MessageProto{Role: "user", Content: msgContent}, threadId)
 
 	if err != nil {
 		return err
@@ -146,36 +223,79 @@ func (c OptimizationController) writeUserPrompt(threadId string, prompt string)
 	return nil
 }
 
+const ratingInstruct = `
+		Rate every suggestion with a 'severity' of either "critical", "major" or "minor" and an 'impact' between 1 and 10 that estimates how much applying the suggestion improves the model instructions.
+		`
+
 type shotInstruct struct {
 	Instruct string
 	Ctx      string
 }
 
-func (c OptimizationController) getShotPrompt(wrongShots *[]domain.Suggestion) (*shotInstruct, error) {
-	shots, err := json.Marshal(*wrongShots)
+// analyzerShots are the rated suggestions of previous optimizations in the lineage
+type analyzerShots struct {
+	Wrong []domain.Suggestion
+	Good  []domain.Suggestion
+}
 
-	if err != nil {
-		return nil, err
-	}
+func (s analyzerShots) empty() bool {
+	return len(s.Wrong) == 0 && len(s.Good) == 0
+}
+
+func (c OptimizationController) getShotPrompt(shots analyzerShots) (*shotInstruct, error) {
+	var instruct string
+	var ctx string
+
+	if len(shots.Wrong) != 0 {
+		wrongShots, err := json.Marshal(shots.Wrong)
+
+		if err != nil {
+			return nil, err
+		}
 
-	instruct := `.
+		instruct += `.
 
 			Study the included 'Wrong Shots', which represent suggestions that you have made in your last optimization attempt. Those were not creating enough value for the user.
 			Only create suggestions that are covering issues different from the ones included in the wrong shots
 			`
-	ctx := fmt.Sprintf(
-		`Wrong Shots:
+		ctx += fmt.Sprintf(
+			`Wrong Shots:
+
+			%s
+		`, wrongShots)
+	}
+
+	if len(shots.Good) != 0 {
+		goodShots, err := json.Marshal(shots.Good)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if instruct == "" {
+			instruct = "."
+		}
+
+		instruct += `
+
+			Study the included 'Good Shots', which represent suggestions that you have made in previous optimization attempts. The user explicitly liked those.
+			Create suggestions that provide the same kind of value, without repeating suggestions that the model instructions already follow
+			`
+		ctx += fmt.Sprintf(
+			`Good Shots:
 
 			%s
-		`, shots)
+		`, goodShots)
+	}
+
 	return &shotInstruct{Instruct: instruct, Ctx: ctx}, nil
 }
 
-func (c OptimizationController) genCustomAssistantUserPrompt(customInstructions string, prompt string, wrongShots *[]domain.Suggestion) (string, error) {
+func (c OptimizationController) genCustomAssistantUserPrompt(customInstructions string, prompt string, shots analyzerShots, preferences string, protected string) (string, error) {
 	var shotInstruct string
 	var shotCtx string
-	if *wrongShots != nil && len(*wrongShots) != 0 {
-		shotInstructs, err := c.getShotPrompt(wrongShots)
+	if !shots.empty() {
+		shotInstructs, err := c.getShotPrompt(shots)
 
 		if err != nil {
 			return "", err
@@ -187,7 +307,7 @@ func (c OptimizationController) genCustomAssistantUserPrompt(customInstructions
 
 	return fmt.Sprintf(
 		`Evaluate the the following "Model Instruction" against the "Custom Goal"%s:
-		
+		%s
 		Custom Goal:
 		%s
 		
@@ -197,15 +317,19 @@ func (c OptimizationController) genCustomAssistantUserPrompt(customInstructions
 
 
 		%s
-		`, shotInstruct, customInstructions, prompt, shotCtx), nil
+
+		%s
+
+		%s
+		`, shotInstruct, ratingInstruct+scoreInstruct, customInstructions, prompt, protected, shotCtx, preferences), nil
 }
 
-func (c OptimizationController) genAssistantUserPrompt(assistantName string, prompt string, wrongShots *[]domain.Suggestion) (string, error) {
+func (c OptimizationController) genAssistantUserPrompt(assistantName string, prompt string, shots analyzerShots, preferences string, protected string) (string, error) {
 
 	var shotInstruct string
 	var shotCtx string
-	if *wrongShots != nil && len(*wrongShots) != 0 {
-		shotInstructs, err := c.getShotPrompt(wrongShots)
+	if !shots.empty() {
+		shotInstructs, err := c.getShotPrompt(shots)
 
 		if err != nil {
 			return "", err
@@ -217,20 +341,25 @@ func (c OptimizationController) genAssistantUserPrompt(assistantName string, pro
 
 	return fmt.Sprintf(
 		`Evaluate the %s of the following "Model Instructions"%s:
-
+		%s
 		Model Instructions:
 
 		%s
 
 		%s
-		`, strings.Join(strings.Split(assistantName, "_"), " "), shotInstruct, prompt, shotCtx), nil
+
+		%s
+
+		%s
+		`, strings.Join(strings.Split(assistantName, "_"), " "), shotInstruct, ratingInstruct+scoreInstruct, prompt, protected, shotCtx, preferences), nil
 }
 
-func (c OptimizationController) genOperatorUserPrompt(originalPrompt string, msg []byte) string {
+func (c OptimizationController) genOperatorUserPrompt(originalPrompt string, msg []byte, protected string, budget string) string {
 
 	return fmt.Sprintf(
 		`Apply the following list of suggestions to improve the following model instructions.
 		Make sure to apply all suggestions and to weight suggestions of type 'custom' higher than the other suggestions .
+		Give precedence to suggestions with a higher 'severity' and 'impact' when suggestions conflict.
 
 		Model Instructions:
 
@@ -241,56 +370,201 @@ func (c OptimizationController) genOperatorUserPrompt(originalPrompt string, msg
 
 		%s
 
-		`, originalPrompt, msg)
+
+		%s
+
+		%s
+		`, originalPrompt, msg, protected, budget)
+}
+
+func (c OptimizationController) genShortenUserPrompt(prompt string, tokens int, protected string, budget string) string {
+
+	return fmt.Sprintf(
+		`The following model instructions have %d tokens, which exceeds the token budget. Shorten them
+		without changing their meaning and return them in the same format. Don't apply any other changes.
+
+		Model Instructions:
+
+		%s
+
+
+		%s
+
+		%s
+		`, tokens, prompt, protected, budget)
 }
 
-func (c OptimizationController) apply(suggestions []oaiSuggestion) ([]byte, error) {
+// runOperator runs the operator in a new thread
+func (c OptimizationController) runOperator(ctx context.Context, userPrompt string, usage *usageMeter) ([]byte, error) {
 	operator := assistant{Id: "asst_qUn97Ck3zzdvNToMVAMhNzTk", Name: "operator"}
+	ctx = withLog(ctx, "analyzer", operator.Name)
 
-	bSuggs, err := json.Marshal(suggestions)
+	thId, err := c.Repo.OAIRepo.PostThread(ctx)
 
 	if err != nil {
 		return nil, err
 	}
 
-	userPrompt := c.genOperatorUserPrompt(operator.Name, bSuggs)
+	defer func() {
+		err = c.Repo.OAIRepo.DeleteThread(ctx, thId)
+		if err != nil {
+			logger(ctx).Error("Deleting thread failed", "error", err)
+		}
+	}()
+
+	return c.runAssistant(ctx, thId, userPrompt, operator, usage)
+}
+
+func (c OptimizationController) apply(ctx context.Context, base optimizationBase, suggestions []oaiSuggestion, encoding string) (msg []byte, err error) {
+	ctx, span := tracing.Start(ctx, "apply", tracing.Int("suggestions", len(suggestions)))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
 
-	thId, err := c.Repo.OAIRepo.PostThread()
+	bSuggs, err := json.Marshal(suggestions)
 
 	if err != nil {
 		return nil, err
 	}
 
-	defer func() {
-		err = c.Repo.OAIRepo.DeleteThread(thId)
-		if err != nil {
-			slog.Error(fmt.Sprintf("Error occured: %s", err.Error()))
-		}
-	}()
+	prompt := base.Prompt
+	if len(base.Messages) > 0 {
+		prompt = chatOperatorCtx(base.Messages)
+	}
+
+	userPrompt := c.genOperatorUserPrompt(prompt, bSuggs, variablesCtx(base.Variables), budgetCtx(base.MaxTokens, encoding))
+
+	return c.runOperator(ctx, userPrompt, base.Usage)
+}
 
-	msg, err := c.runAssistant(thId, userPrompt, operator)
+// operatorOutput turns the operator's chat prompts back into the canonical format. Output that
+// isn't a valid chat prompt is rejected, as storing it would replace the messages with raw text.
+func (c OptimizationController) operatorOutput(base optimizationBase, msg []byte) ([]byte, error) {
+	if len(base.Messages) == 0 {
+		return msg, nil
+	}
+
+	messages, err := parseOperatorChat(msg, base.Messages)
+
+	if err != nil {
+		return nil, err
+	}
+
+	formatted, err := formatChatPrompt(messages)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return msg, nil
+	return []byte(formatted), nil
+}
+
+// fitBudget verifies the optimized prompt respects the token budget. The operator gets one
+// attempt to shorten a prompt that doesn't. A prompt that still exceeds the budget is kept and
+// the editor tells the user so, as its token summary compares the prompt with the stored budget.
+func (c OptimizationController) fitBudget(ctx context.Context, opId string, base optimizationBase, counter tokenCounter, msg []byte) []byte {
+	count := counter.countPrompt(string(msg))
+	if base.MaxTokens <= 0 || count.Tokens <= base.MaxTokens {
+		return msg
+	}
+
+	fitted := c.shorten(ctx, base, counter, msg, count)
+
+	if tokens := counter.countPrompt(string(fitted)).Tokens; tokens > base.MaxTokens {
+		tracing.SpanFromContext(ctx).SetAttributes(tracing.Bool("optimization.over_budget", true))
+		logger(ctx).Warn("Optimization exceeds its token budget", "budget", base.MaxTokens, "tokens", tokens)
+	}
+
+	return fitted
+}
+
+// shorten returns the shortened prompt if the operator managed to reduce its token count
+func (c OptimizationController) shorten(ctx context.Context, base optimizationBase, counter tokenCounter, msg []byte, count TokenCount) []byte {
+	prompt := string(msg)
+	if messages, ok := parseChatPrompt(prompt); ok {
+		prompt = chatOperatorCtx(messages)
+	}
+
+	shortened, err := c.runOperator(ctx, c.genShortenUserPrompt(prompt, count.Tokens, variablesCtx(base.Variables),
+		budgetCtx(base.MaxTokens, counter.encodingName)), base.Usage)
+
+	if err != nil {
+		logger(ctx).Error("Shortening optimized prompt failed", "error", err)
+		return msg
+	} else if len(shortened) == 0 {
+		return msg
+	}
+
+	shortened, err = c.operatorOutput(base, shortened)
+
+	if err != nil {
+		logger(ctx).Warn("Operator returned an invalid shortened chat prompt", "error", err)
+		return msg
+	}
+
+	if counter.countPrompt(string(shortened)).Tokens >= count.Tokens {
+		return msg
+	}
+
+	return shortened
 }
 
 type optimizationBase struct {
 	Prompt       string
 	Instructions string
+	MaxTokens    int
+	// Usage sums the tokens consumed by the model calls of the optimization
+	Usage     *usageMeter
+	Variables []TemplateVariable
+	// Messages is set for chat prompts
+	Messages []domain.ChatMessage
+	// Custom are the custom analyzers selected for the optimization
+	Custom []domain.CustomAnalyzer
+}
+
+// assistants are the built-in analyzers followed by the selected custom analyzers
+func (b optimizationBase) assistants() []assistant {
+	return append(append([]assistant{}, analyzers...), customAssistants(b.Custom)...)
+}
+
+// goal is what the assistant evaluates the prompt against, if it isn't one of the built-in dimensions
+func (a assistant) goal(base optimizationBase) string {
+	if a.Name == "custom" {
+		return base.Instructions
+	}
+
+	return a.Instructions
+}
+
+// analyzerCtx is the prompt as presented to analyzers
+func (b optimizationBase) analyzerCtx() string {
+	if len(b.Messages) > 0 {
+		return chatAnalyzerCtx(b.Messages)
+	}
+
+	return b.Prompt
+}
+
+// messageIndex drops indices of suggestions that don't refer to a message of the prompt
+func (b optimizationBase) messageIndex(index *int) *int {
+	if index == nil || *index < 0 || *index >= len(b.Messages) {
+		return nil
+	}
+
+	return index
 }
 
 type suggestArgs struct {
-	WrongShots *[]domain.Suggestion
-	Base       optimizationBase
-	Assistant  assistant
-	OpId       string
-	ThId       string
+	Shots       analyzerShots
+	Preferences string
+	Base        optimizationBase
+	Assistant   assistant
+	OpId        string
+	ThId        string
 }
 
-func (c OptimizationController) suggest(args suggestArgs) ([]oaiSuggestion, error) {
+func (c OptimizationController) suggest(ctx context.Context, args suggestArgs) ([]domain.Suggestion, error) {
 	runId := uuid.New().String()
 	run := domain.Run{
 		Id:             runId,
@@ -298,153 +572,312 @@ func (c OptimizationController) suggest(args suggestArgs) ([]oaiSuggestion, erro
 		State:          "running",
 		OptimizationId: args.OpId}
 
-	err := c.Repo.RunRepo.Insert(run)
+	ctx, span := tracing.Start(ctx, "suggest", tracing.String("optimization.id", args.OpId),
+		tracing.String("analyzer", args.Assistant.Name), tracing.String("run.id", runId))
+	defer span.End()
+	ctx = withLog(ctx, "run_id", runId)
+
+	err := c.Repo.RunRepo.Insert(ctx, run)
 
 	if err != nil {
+		span.RecordError(err)
 		return nil, err
 	}
 
+	start := time.Now()
+	outcome := "completed"
+
 	defer func() {
+		if err != nil {
+			outcome = "failed"
+			span.RecordError(err)
+		}
+		span.SetAttributes(tracing.String("outcome", outcome))
+		analyzerRuns.Inc(metricAnalyzer(args.Assistant.Name), outcome)
+		analyzerDuration.Observe(time.Since(start).Seconds(), metricAnalyzer(args.Assistant.Name), outcome)
+
 		if err == nil {
-			err = c.Repo.RunRepo.Update(runId, "completed")
+			err = c.Repo.RunRepo.Update(ctx, runId, "completed")
 			if err != nil {
-				slog.Error(fmt.Sprintf("Error occured: %s", err.Error()))
+				logger(ctx).Error("Updating run state failed", "error", err)
 			}
 		} else {
-			err = c.Repo.RunRepo.Update(runId, "failed")
+			err = c.Repo.RunRepo.Update(ctx, runId, "failed")
 			if err != nil {
-				slog.Error(fmt.Sprintf("Error occured: %s", err.Error()))
+				logger(ctx).Error("Updating run state failed", "error", err)
 			}
 		}
 
 	}()
 
 	var userPrompt string
-	if args.Assistant.Name == "custom" {
-		if args.Base.Instructions == "" {
-			return []oaiSuggestion{}, nil
+	if goal := args.Assistant.goal(args.Base); args.Assistant.Name == "custom" || goal != "" {
+		if goal == "" {
+			return []domain.Suggestion{}, nil
 		}
 
-		userPrompt, err = c.genCustomAssistantUserPrompt(args.Base.Instructions, args.Base.Prompt, args.WrongShots)
+		userPrompt, err = c.genCustomAssistantUserPrompt(goal, args.Base.analyzerCtx(), args.Shots, args.Preferences,
+			variablesCtx(args.Base.Variables))
 
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		userPrompt, err = c.genAssistantUserPrompt(args.Assistant.Name, args.Base.Prompt, args.WrongShots)
+		userPrompt, err = c.genAssistantUserPrompt(args.Assistant.Name, args.Base.analyzerCtx(), args.Shots, args.Preferences,
+			variablesCtx(args.Base.Variables))
 
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	msg, err := c.runAssistant(args.ThId, userPrompt, args.Assistant)
+	msg, err := c.runAssistant(ctx, args.ThId, userPrompt, args.Assistant, args.Base.Usage)
 
 	if err != nil {
 		return nil, err
 	} else if len(msg) == 0 {
 		// handling timed out assistant runs
-		return make([]oaiSuggestion, 0), nil
+		outcome = "timed_out"
+		return make([]domain.Suggestion, 0), nil
 	}
 
-	var suggestions *[]oaiSuggestion
-	suggestions, err = ReadJSON[[]oaiSuggestion](msg)
+	var analysis *oaiAnalysis
+	analysis, err = parseAnalysis(msg)
 
 	if err != nil {
-		slog.Warn(fmt.Sprintf("Assistant %s produced unparseable JSON suggestions. Ignoring suggestions...", args.Assistant.Name))
+		outcome = "unparseable"
+		logger(ctx).Warn("Assistant produced unparseable JSON suggestions, ignoring suggestions")
 		// to accommodate defer statement
 		err = nil
-		return make([]oaiSuggestion, 0), nil
+		return make([]domain.Suggestion, 0), nil
+	}
+
+	// a missing score leaves the dimension out of the scorecard, the suggestions are still used
+	if analysis.Score != nil {
+		score := normalizeScore(*analysis.Score)
+		err = c.Repo.RunRepo.UpdateScores(ctx, runId, RunScoreOpts{Score: &score, Rationale: analysis.Rationale})
+
+		if err != nil {
+			logger(ctx).Error("Storing score failed", "error", err)
+			err = nil
+		}
 	}
 
-	suggestionRecords := make([]domain.Suggestion, len(*suggestions))
-	for i := 0; i < len(*suggestions); i++ {
+	suggestions := analysis.Suggestions
+	suggestionRecords := make([]domain.Suggestion, len(suggestions))
+	for i := 0; i < len(suggestions); i++ {
 		suggestionRecords[i] = domain.Suggestion{
 			Id:             uuid.New().String(),
-			Suggestion:     (*suggestions)[i].Suggestion,
-			Reasoning:      (*suggestions)[i].Reasoning,
+			Suggestion:     suggestions[i].Suggestion,
+			Reasoning:      suggestions[i].Reasoning,
 			UserFeedback:   0,
-			Target:         (*suggestions)[i].Target,
+			Target:         suggestions[i].Target,
+			Severity:       normalizeSeverity(suggestions[i].Severity),
+			Impact:         normalizeImpact(float64(suggestions[i].Impact)),
 			Type:           args.Assistant.Name,
+			Analyzers:      []string{args.Assistant.Name},
 			RunId:          runId,
-			OptimizationId: args.OpId}
+			OptimizationId: args.OpId,
+			MessageIndex:   args.Base.messageIndex(suggestions[i].MessageIndex)}
+	}
+
+	logger(ctx).Info("Successfully generated suggestions", "count", len(suggestionRecords))
+
+	return suggestionRecords, nil
+}
+
+func (c OptimizationController) groupByType(shots *[]domain.Suggestion, shotsByType *map[string][]domain.Suggestion) {
+	for i := 0; i < len(*shots); i++ {
+		shot := (*shots)[i]
+
+		// merged suggestions count as shots for every analyzer that agreed on them
+		types := shot.Analyzers
+		if len(types) == 0 {
+			types = []string{shot.Type}
+		}
+
+		for j := 0; j < len(types); j++ {
+			_, ok := (*shotsByType)[types[j]]
+			if ok {
+				(*shotsByType)[types[j]] = append((*shotsByType)[types[j]], shot)
+			} else {
+				(*shotsByType)[types[j]] = []domain.Suggestion{shot}
+			}
+		}
+	}
+}
+
+// readShots collects the rated suggestions of the parent optimization and its ancestors.
+// Suggestions of more recent versions come first, so they survive the per analyzer limits.
+func (c OptimizationController) readShots(ctx context.Context, parentId string, assistants []assistant) (map[string]analyzerShots, error) {
+	shotsByAnalyzer := make(map[string]analyzerShots)
+
+	if parentId == "" {
+		return shotsByAnalyzer, nil
 	}
 
-	err = c.Repo.SuggRepo.Insert(suggestionRecords)
+	lineage, err := readLineage(ctx, c.Repo.OpRepo, parentId)
 
 	if err != nil {
 		return nil, err
 	}
 
-	slog.Info(fmt.Sprintf("Successfully generated %s suggestions", args.Assistant.Name))
+	ids := lineageIds(*lineage)
+	rank := make(map[string]int)
+	for i := 0; i < len(ids); i++ {
+		rank[ids[i]] = i
+	}
 
-	return *suggestions, nil
-}
+	read := func(uFeedbCond string, limit int) (map[string][]domain.Suggestion, error) {
+		shotsByType := make(map[string][]domain.Suggestion)
 
-func (c OptimizationController) groupByType(shots *[]domain.Suggestion, shotsByType *map[string][]domain.Suggestion) {
-	for i := 0; i < len(*shots); i++ {
-		shot := (*shots)[i]
+		if limit <= 0 {
+			return shotsByType, nil
+		}
 
-		_, ok := (*shotsByType)[shot.Type]
-		if ok {
-			(*shotsByType)[shot.Type] = append((*shotsByType)[shot.Type], shot)
-		} else {
-			(*shotsByType)[shot.Type] = []domain.Suggestion{shot}
+		shots, err := c.Repo.SuggRepo.Read(ctx, SuggReadFilter{OpIdCond: inCond(ids), UFeedbCond: uFeedbCond})
+
+		if err != nil {
+			return nil, err
+		}
+
+		sort.SliceStable(*shots, func(i, j int) bool {
+			return rank[(*shots)[i].OptimizationId] < rank[(*shots)[j].OptimizationId]
+		})
+
+		c.groupByType(shots, &shotsByType)
+
+		for analyzer, typeShots := range shotsByType {
+			if len(typeShots) > limit {
+				shotsByType[analyzer] = typeShots[:limit]
+			}
 		}
+
+		return shotsByType, nil
+	}
+
+	wrongShots, err := read("eq.-1", c.Config.WrongShotLimit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	goodShots, err := read("eq.1", c.Config.GoodShotLimit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(assistants); i++ {
+		name := assistants[i].Name
+		shotsByAnalyzer[name] = analyzerShots{Wrong: wrongShots[name], Good: goodShots[name]}
 	}
+
+	return shotsByAnalyzer, nil
 }
 
-func (c OptimizationController) optimize(opId string, parentId string, base optimizationBase) {
-	assistants := []assistant{{Id: "asst_BxUQqxSD8tcvQoyR6T5iom3L", Name: "contextual_richness"},
-		{Id: "asst_3q6LvmiPZyoPChdrcuqMxOvh", Name: "conciseness"},
-		{Id: "asst_8IjCbTm7tsgCtSbhEL7E7rjB", Name: "clarity"},
-		{Id: "asst_221Q0E9EeazCHcGV4Qd050Gy", Name: "consistency"},
-		{Id: "asst_9zcQxyRh4E10Agg08p8mYDO8", Name: "custom"}}
+// mergeDuplicates orders the suggestions by analyzer, so the outcome doesn't depend on which run
+// finished first, before merging duplicates
+func (c OptimizationController) mergeDuplicates(ctx context.Context, base optimizationBase, assistants []assistant, records []domain.Suggestion) []domain.Suggestion {
+	rank := make(map[string]int)
+	for i := 0; i < len(assistants); i++ {
+		rank[assistants[i].Name] = i
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return rank[records[i].Type] < rank[records[j].Type]
+	})
 
-	shotsByType := make(map[string][]domain.Suggestion)
-	if parentId != "" {
-		wrongShots, err := c.Repo.SuggRepo.Read(SuggReadFilter{OpIdCond: fmt.Sprintf("eq.%s", parentId), UFeedbCond: "eq.-1"})
+	consolidated := consolidate(base.Prompt, base.Messages, records)
+
+	if len(consolidated) < len(records) {
+		logger(ctx).Info("Merged duplicate suggestions", "count", len(records)-len(consolidated))
+	}
+
+	return consolidated
+}
+
+func (c OptimizationController) optimize(ctx context.Context, opId string, parentId string, sessionId string, base optimizationBase) {
+	ctx, span := tracing.Start(ctx, "optimize", tracing.String("optimization.id", opId),
+		tracing.String("parent.id", parentId))
+	defer span.End()
+
+	start := time.Now()
+	state := "failed"
+	defer func() {
+		span.SetAttributes(tracing.String("state", state))
+		if state == "failed" {
+			span.RecordError(errors.New("optimization failed"))
+
+			// the failed state ends the batch progress and history polling of the optimization
+			opts := OpUpdateOpts{State: state, ParentId: parentId, TokensUsed: base.Usage.total()}
+			if err := c.Repo.OpRepo.Update(ctx, opId, opts); err != nil {
+				logger(ctx).Error("Storing failed optimization state failed", "error", err)
+			}
+		}
+		optimizations.Inc(state)
+		optimizationDuration.Observe(time.Since(start).Seconds(), state)
+	}()
+
+	assistants := base.assistants()
+
+	shotsByAnalyzer, err := c.readShots(ctx, parentId, assistants)
+
+	if err != nil {
+		logger(ctx).Error("Reading shots failed", "error", err)
+		return
+	}
+
+	// the profile only refines the analysis, so optimizing continues without it
+	profile := &PreferenceProfile{SessionId: sessionId}
+	if sessionId != "" {
+		profile, err = readPreferenceProfile(ctx, c.Repo, sessionId)
 
 		if err != nil {
-			slog.Error(fmt.Sprintf("Error occured: %s", err.Error()))
-			return
+			logger(ctx).Error("Reading preference profile failed", "error", err)
+			profile = &PreferenceProfile{SessionId: sessionId}
 		}
+	}
 
-		c.groupByType(wrongShots, &shotsByType)
+	lintRecords, err := c.lint(ctx, opId, base)
+
+	if err != nil {
+		logger(ctx).Error("Linting failed", "error", err)
 	}
 
 	var wg sync.WaitGroup
-	outputCh := make(chan []oaiSuggestion)
+	outputCh := make(chan []domain.Suggestion)
 
 	for i := 0; i < len(assistants); i++ {
 		wg.Add(1)
-		go func(id int) {
+		go func(ctx context.Context, id int) {
 			defer wg.Done()
 
-			thId, err := c.Repo.OAIRepo.PostThread()
+			thId, err := c.Repo.OAIRepo.PostThread(ctx)
 
 			if err != nil {
-				slog.Error(fmt.Sprintf("Error occured: %s", err.Error()))
+				logger(ctx).Error("Creating thread failed", "error", err)
 				return
 			}
 
 			defer func() {
-				err = c.Repo.OAIRepo.DeleteThread(thId)
+				err = c.Repo.OAIRepo.DeleteThread(ctx, thId)
 				if err != nil {
-					slog.Error(fmt.Sprintf("Error occured: %s", err.Error()))
+					logger(ctx).Error("Deleting thread failed", "error", err)
 				}
 			}()
 
-			shots := shotsByType[assistants[id].Name]
-			suggestions, err := c.suggest(suggestArgs{OpId: opId, ThId: thId, Base: base, Assistant: assistants[id], WrongShots: &shots})
+			shots := shotsByAnalyzer[assistants[id].Name]
+			suggestions, err := c.suggest(ctx, suggestArgs{OpId: opId, ThId: thId, Base: base, Assistant: assistants[id], Shots: shots,
+				Preferences: profile.preferenceCtx(assistants[id].Name)})
 
 			if err != nil {
-				slog.Error(fmt.Sprintf("Error occured: %s", err.Error()))
+				logger(ctx).Error("Analyzer run failed", "error", err)
 				return
 			}
 
 			outputCh <- suggestions
-		}(i)
+		}(withLog(ctx, "analyzer", assistants[i].Name), i)
 	}
 
 	go func() {
@@ -452,75 +885,192 @@ func (c OptimizationController) optimize(opId string, parentId string, base opti
 		close(outputCh)
 	}()
 
-	var suggestions []oaiSuggestion
+	records := lintRecords
 	for {
 		output, ok := <-outputCh
 		if !ok {
 			break
 		}
-		suggestions = append(suggestions, output...)
+		records = append(records, output...)
+	}
+
+	records = c.mergeDuplicates(ctx, base, assistants, records)
+
+	if len(records) > 0 {
+		err := c.Repo.SuggRepo.Insert(ctx, records)
+
+		if err != nil {
+			logger(ctx).Error("Storing suggestions failed", "error", err)
+			return
+		}
+	}
+
+	suggestions := make([]oaiSuggestion, len(records))
+	for i := 0; i < len(records); i++ {
+		suggestions[i] = oaiSuggestion{
+			Suggestion:   records[i].Suggestion,
+			Reasoning:    records[i].Reasoning,
+			Target:       records[i].Target,
+			Severity:     records[i].Severity,
+			Impact:       formNumber(records[i].Impact),
+			MessageIndex: records[i].MessageIndex}
+	}
+
+	counter := newTokenCounter(c.Config)
+
+	msg, err := c.apply(ctx, base, suggestions, counter.encodingName)
+
+	if err != nil {
+		logger(ctx).Error("Applying suggestions failed", "error", err)
+		return
 	}
 
-	msg, err := c.apply(suggestions)
+	msg, err = c.operatorOutput(base, msg)
 
 	if err != nil {
-		slog.Error(fmt.Sprintf("Error occured: %s", err.Error()))
+		logger(ctx).Error("Operator returned an invalid chat prompt", "error", err)
 		return
 	}
 
+	msg = c.fitBudget(ctx, opId, base, counter, msg)
+
+	if check := checkVariables(base.Variables, string(msg)); !check.Preserved() {
+		logger(ctx).Warn("Optimization changed template variables", "missing", variableTokens(check.Missing),
+			"added", variableTokens(check.Added))
+	}
+
+	c.rescore(ctx, opId, base, string(msg))
+
 	var opts OpUpdateOpts
 	opts.State = "completed"
 	opts.OptimizedPrompt = string(msg)
+	opts.TokensUsed = base.Usage.total()
 	if parentId != "" {
 		opts.ParentId = parentId
 	}
 
-	c.Repo.OpRepo.Update(opId, opts)
+	if err = c.Repo.OpRepo.Update(ctx, opId, opts); err != nil {
+		logger(ctx).Error("Storing optimized prompt failed", "error", err)
+		return
+	}
+
+	state = "completed"
 }
 
-func (c OptimizationController) run(opId string, parentId string, body []byte) {
+func (c OptimizationController) run(ctx context.Context, opId string, parentId string, sessionId string, body []byte) {
+	ctx = withLog(ctx, "optimization_id", opId)
+
 	opReqBody, err := ReadJSON[optimizationReq](body)
 
 	if err != nil {
-		slog.Error(fmt.Sprintf("Error occured: %s", err.Error()))
+		logger(ctx).Error("Reading optimization request failed", "error", err)
 		return
 	}
 
 	if parentId != "" {
-		c.Repo.PHRepo.Capture(fmt.Sprintf("%s_user_regenerated", c.Config.Env), opId)
+		c.Repo.PHRepo.Capture(ctx, fmt.Sprintf("%s_user_regenerated", c.Config.Env), opId)
 	} else {
-		c.Repo.PHRepo.Capture(fmt.Sprintf("%s_user_generated", c.Config.Env), opId)
+		c.Repo.PHRepo.Capture(ctx, fmt.Sprintf("%s_user_generated", c.Config.Env), opId)
 	}
 
-	optimization := domain.Optimization{
-		Id:              opId,
-		OriginalPrompt:  opReqBody.OriginalPrompt,
-		Instructions:    opReqBody.Instructions,
-		ParentId:        parentId,
-		OptimizedPrompt: "",
-		State:           "pending"}
-
-	err = c.Repo.OpRepo.Insert(optimization)
+	prompt, err := opReqBody.prompt()
 
 	if err != nil {
-		slog.Error(fmt.Sprintf("Error occured: %s", err.Error()))
+		logger(ctx).Error("Reading prompt failed", "error", err)
 		return
 	}
 
-	c.optimize(opId, parentId, optimizationBase{Prompt: opReqBody.OriginalPrompt,
-		Instructions: opReqBody.Instructions})
-}
-
-func (c OptimizationController) readAnalysisState(optimizationId string) (*AnalysisState, error) {
-	records, err := c.Repo.RunRepo.Read(RunReadFilter{OptimizationId: optimizationId})
+	custom, err := readOwnedAnalyzers(ctx, c.Repo, opReqBody.Analyzers, sessionId)
 
 	if err != nil {
-		return nil, err
+		logger(ctx).Error("Reading analyzers failed", "error", err)
+		return
 	}
 
-	var state AnalysisState
-	for i := 0; i < len(*records); i++ {
-		record := (*records)[i]
+	optimization := domain.Optimization{
+		Id:              opId,
+		OriginalPrompt:  prompt,
+		Instructions:    opReqBody.Instructions,
+		MaxTokens:       int(opReqBody.MaxTokens),
+		Analyzers:       analyzerIds(custom),
+		ParentId:        parentId,
+		SessionId:       sessionId,
+		OptimizedPrompt: "",
+		State:           "pending"}
+
+	// regenerated versions stay part of the library prompt their parent belongs to and keep its
+	// custom analyzers unless others were selected
+	if parentId != "" {
+		parent, err := c.Repo.OpRepo.Read(ctx, parentId)
+
+		if err != nil {
+			logger(ctx).Error("Reading parent optimization failed", "error", err)
+		} else {
+			optimization.LibraryPromptId = parent.LibraryPromptId
+			optimization.Redactions = parent.Redactions
+			if len(optimization.Analyzers) == 0 {
+				optimization.Analyzers = parent.Analyzers
+			}
+		}
+	}
+
+	c.start(ctx, optimization)
+}
+
+func (c OptimizationController) start(ctx context.Context, optimization domain.Optimization) {
+	// the optimization continues with the built-in analyzers if the custom ones can't be read
+	custom, err := readCustomAnalyzers(ctx, c.Repo, optimization.Analyzers)
+
+	if err != nil {
+		logger(ctx).Error("Reading custom analyzers failed", "error", err)
+	}
+
+	// nothing is stored or sent to a model if the prompt can't be redacted
+	optimization, custom, err = redactOptimization(c.Config, optimization, custom)
+
+	if err != nil {
+		logger(ctx).Error("Redacting prompt failed", "error", err)
+		return
+	}
+
+	err = c.Repo.OpRepo.Insert(ctx, optimization)
+
+	if err != nil {
+		logger(ctx).Error("Storing optimization failed", "error", err)
+		return
+	}
+
+	base := optimizationBase{Prompt: optimization.OriginalPrompt, Instructions: optimization.Instructions,
+		MaxTokens: optimization.MaxTokens, Variables: detectVariables(optimization.OriginalPrompt), Usage: &usageMeter{},
+		Custom: custom}
+	if messages, ok := parseChatPrompt(optimization.OriginalPrompt); ok {
+		base.Messages = messages
+	}
+
+	c.optimize(ctx, optimization.Id, optimization.ParentId, optimization.SessionId, base)
+}
+
+func (c OptimizationController) readAnalysisState(ctx context.Context, optimizationId string) (*AnalysisState, error) {
+	records, err := c.Repo.RunRepo.Read(ctx, RunReadFilter{OptimizationId: optimizationId})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the optimization may not be stored yet while its first runs are pending
+	if len(*records) == 0 {
+		return &AnalysisState{}, nil
+	}
+
+	custom, err := readOpAnalyzers(ctx, c.Repo, optimizationId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	state := AnalysisState{Custom: analyzerProgress(custom)}
+	for i := 0; i < len(*records); i++ {
+		record := (*records)[i]
 		runCompleted := record.State == "completed"
 		switch record.Type {
 		case "contextual_richness":
@@ -533,8 +1083,18 @@ func (c OptimizationController) readAnalysisState(optimizationId string) (*Analy
 			state.ConsistencyCompleted = runCompleted
 		case "custom":
 			state.CustomCompleted = runCompleted
+		case lintAnalyzer:
+			state.LintCompleted = runCompleted
+		case securityAnalyzer:
+			state.securityRun = true
+			state.SecurityCompleted = runCompleted
 		default:
-			return nil, errors.New("unexpected run type error")
+			// runs of custom analyzers deleted in the meantime are ignored
+			for j := 0; j < len(state.Custom); j++ {
+				if state.Custom[j].Name == record.Type {
+					state.Custom[j].Completed = runCompleted
+				}
+			}
 		}
 	}
 
@@ -575,12 +1135,26 @@ func (c AppController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
 
 type DraftModeEditorController struct {
 	ComponentBuilder *ComponentBuilder
+	Repo             *Repo
+	Config           *Config
 }
 
 func (c DraftModeEditorController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
 	switch r.Method {
 	case "GET":
-		return &AppResp{Component: c.ComponentBuilder.Draft(), Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+		analyzers, err := readSessionAnalyzers(ctx, c.Repo, readSession(w, r, c.Config))
+
+		if err != nil {
+			errConfig500 := get500()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		return &AppResp{Component: c.ComponentBuilder.Draft(analyzers, !c.Config.RedactionDisabled), Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
 	default:
 		errConfig := get405()
 		err := errors.New("method not allowed")
@@ -597,7 +1171,70 @@ type SuggestionController struct {
 }
 
 func (c SuggestionController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
 	switch r.Method {
+	case "GET":
+		opId := r.URL.Query().Get("op_id")
+
+		if opId == "" {
+			errConfig400 := get400()
+			err := errors.New("missing query parameter")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		op, err := readOwnedOptimization(ctx, c.Repo.OpRepo, opId, readSession(w, r, c.Config))
+
+		if errors.Is(err, errNotOwned) {
+			errConfig403 := get403()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+				Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+		} else if err != nil {
+			errConfig500 := get500()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		custom, err := readCustomAnalyzers(ctx, c.Repo, op.Analyzers)
+
+		if err != nil {
+			errConfig500 := get500()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		view := readSuggView(r, custom)
+		suggs, err := c.Repo.SuggRepo.Read(ctx, view.filter(SuggReadFilter{}))
+
+		if err != nil {
+			errConfig500 := get500()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		if err = restoreSuggestions(c.Config, *op, *suggs); err != nil {
+			errConfig500 := get500()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		view.sort(*suggs)
+		view.TokenDeltas = newTokenCounter(c.Config).deltas(*suggs)
+
+		return &AppResp{Component: c.ComponentBuilder.SuggestionWindow(suggs, view),
+			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
 	case "PATCH":
 		id := r.URL.Query().Get("sugg_id")
 		opId := r.URL.Query().Get("op_id")
@@ -610,9 +1247,81 @@ func (c SuggestionController) Handle(w http.ResponseWriter, r *http.Request) *Ap
 				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
 		}
 
+		sessionId := readSession(w, r, c.Config)
+		op, err := readOwnedOptimization(ctx, c.Repo.OpRepo, opId, sessionId)
+
+		if errors.Is(err, errNotOwned) {
+			errConfig403 := get403()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+				Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+		} else if err != nil {
+			errConfig500 := get500()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		// the suggestion has to belong to the owned optimization
+		rated, err := c.Repo.SuggRepo.Read(ctx, SuggReadFilter{IdCond: fmt.Sprintf("eq.%s", id), OpIdCond: fmt.Sprintf("eq.%s", opId)})
+
+		if err != nil {
+			errConfig500 := get500()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		} else if len(*rated) == 0 {
+			errConfig404 := get404()
+			err = errors.New("suggestion not found")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig404.Code), errConfig404.Title, errConfig404.Msg),
+				Code: errConfig404.Code, Message: errConfig404.Msg, ContentType: "text/html", Error: err}
+		}
+
+		custom, err := readCustomAnalyzers(ctx, c.Repo, op.Analyzers)
+
+		if err != nil {
+			errConfig500 := get500()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		view := readSuggView(r, custom)
+
 		fValI, err := strconv.Atoi(fVal)
 
+		if err != nil || fValI < -1 || fValI > 1 {
+			errConfig400 := get400()
+			err = errors.New("invalid feedback value")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
 		errConfig500 := get500()
+
+		reason, err := redactReason(c.Config, *op, strings.TrimSpace(r.FormValue(fmt.Sprintf("reason-%s", id))))
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		err = c.Repo.FeedbRepo.Insert(ctx, domain.FeedbackEvent{
+			Id:             uuid.New().String(),
+			SuggestionId:   id,
+			OptimizationId: opId,
+			SessionId:      sessionId,
+			Value:          int16(fValI),
+			Reason:         reason})
+
 		if err != nil {
 			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
 				Code:        errConfig500.Code,
@@ -621,7 +1330,9 @@ func (c SuggestionController) Handle(w http.ResponseWriter, r *http.Request) *Ap
 				Error:       err}
 		}
 
-		err = c.Repo.SuggRepo.Update(id, int16(fValI))
+		feedbackEvents.Inc(feedbackValue(int16(fValI)))
+
+		err = c.Repo.SuggRepo.Update(ctx, id, int16(fValI))
 
 		if err != nil {
 			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
@@ -631,7 +1342,7 @@ func (c SuggestionController) Handle(w http.ResponseWriter, r *http.Request) *Ap
 				Error:       err}
 		}
 
-		suggs, err := c.Repo.SuggRepo.Read(SuggReadFilter{OpIdCond: fmt.Sprintf("eq.%s", opId), UFeedbCond: fmt.Sprintf("gt.%d", fValI)})
+		suggs, err := c.Repo.SuggRepo.Read(ctx, view.filter(SuggReadFilter{}))
 
 		if err != nil {
 			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
@@ -641,7 +1352,18 @@ func (c SuggestionController) Handle(w http.ResponseWriter, r *http.Request) *Ap
 				Error:       err}
 		}
 
-		return &AppResp{Component: c.ComponentBuilder.SuggestionWindow(suggs),
+		if err = restoreSuggestions(c.Config, *op, *suggs); err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		view.sort(*suggs)
+		view.TokenDeltas = newTokenCounter(c.Config).deltas(*suggs)
+
+		return &AppResp{Component: c.ComponentBuilder.SuggestionWindow(suggs, view),
 			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
 	default:
 		errConfig := get405()
@@ -658,6 +1380,7 @@ type OptimizationController struct {
 }
 
 func (c OptimizationController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
 	errConfig400 := get400()
 
 	switch r.Method {
@@ -670,9 +1393,27 @@ func (c OptimizationController) Handle(w http.ResponseWriter, r *http.Request) *
 				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
 		}
 
-		state, err := c.readAnalysisState(id)
-
 		errConfig500 := get500()
+
+		// the optimization isn't stored until its prompt is redacted, its progress reveals nothing
+		ops, err := c.Repo.OpRepo.ReadMany(ctx, OpReadFilter{IdCond: fmt.Sprintf("eq.%s", id)})
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		if len(*ops) > 0 && !ownsOptimization((*ops)[0], readSession(w, r, c.Config)) {
+			errConfig403 := get403()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+				Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: errNotOwned}
+		}
+
+		state, err := c.readAnalysisState(ctx, id)
+
 		if err != nil {
 			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
 				Code:        errConfig500.Code,
@@ -682,7 +1423,17 @@ func (c OptimizationController) Handle(w http.ResponseWriter, r *http.Request) *
 		}
 
 		if state.Completed() {
-			op, err := c.Repo.OpRepo.Read(id)
+			op, err := c.Repo.OpRepo.Read(ctx, id)
+
+			if err != nil {
+				return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+					Code:        errConfig500.Code,
+					Message:     errConfig500.Msg,
+					ContentType: "text/html",
+					Error:       err}
+			}
+
+			suggs, err := c.Repo.SuggRepo.Read(ctx, SuggReadFilter{OpIdCond: fmt.Sprintf("eq.%s", id)})
 
 			if err != nil {
 				return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
@@ -692,7 +1443,15 @@ func (c OptimizationController) Handle(w http.ResponseWriter, r *http.Request) *
 					Error:       err}
 			}
 
-			suggs, err := c.Repo.SuggRepo.Read(SuggReadFilter{OpIdCond: fmt.Sprintf("eq.%s", id)})
+			if err = restoreSuggestions(c.Config, *op, *suggs); err != nil {
+				return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+					Code:        errConfig500.Code,
+					Message:     errConfig500.Msg,
+					ContentType: "text/html",
+					Error:       err}
+			}
+
+			custom, err := readCustomAnalyzers(ctx, c.Repo, op.Analyzers)
 
 			if err != nil {
 				return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
@@ -702,8 +1461,36 @@ func (c OptimizationController) Handle(w http.ResponseWriter, r *http.Request) *
 					Error:       err}
 			}
 
+			counter := newTokenCounter(c.Config)
+			view := SuggView{OptimizationId: op.Id, Sort: "severity", Dimensions: append(dimensions(), analyzerNames(custom)...),
+				Labels: analyzerLabels(custom), TokenDeltas: counter.deltas(*suggs)}
+			view.sort(*suggs)
+
 			if op.State == "completed" {
-				return &AppResp{Component: c.ComponentBuilder.Edit(op.Id, op.OriginalPrompt, op.OptimizedPrompt, op.Instructions, suggs),
+				scores, err := readScorecard(ctx, c.Repo, op.Id)
+
+				if err != nil {
+					return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+						Code:        errConfig500.Code,
+						Message:     errConfig500.Msg,
+						ContentType: "text/html",
+						Error:       err}
+				}
+
+				shown, err := restoreOptimization(c.Config, *op)
+
+				if err != nil {
+					return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+						Code:        errConfig500.Code,
+						Message:     errConfig500.Msg,
+						ContentType: "text/html",
+						Error:       err}
+				}
+
+				w.Header().Set("HX-Trigger", "historyChanged")
+				check := checkVariables(detectVariables(op.OriginalPrompt), op.OptimizedPrompt)
+				return &AppResp{Component: c.ComponentBuilder.Edit(op.Id, shown.OriginalPrompt, shown.OptimizedPrompt, shown.Instructions, suggs, view, check,
+					counter.view(op), scores),
 					Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
 			}
 		}
@@ -712,6 +1499,7 @@ func (c OptimizationController) Handle(w http.ResponseWriter, r *http.Request) *
 			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
 	case "POST":
 		parentId := r.URL.Query().Get("parent_id")
+		sessionId := readSession(w, r, c.Config)
 		optimizationId := uuid.New().String()
 
 		body, err := Read(r.Body)
@@ -724,29 +1512,1412 @@ func (c OptimizationController) Handle(w http.ResponseWriter, r *http.Request) *
 				Error:       err}
 		}
 
-		go c.run(optimizationId, parentId, body)
+		// chat prompts and token budgets are validated before the optimization is started
+		opReqBody, err := ReadJSON[optimizationReq](body)
+		if err == nil {
+			_, err = opReqBody.prompt()
+		}
+
+		var custom []domain.CustomAnalyzer
+		if err == nil {
+			custom, err = readOwnedAnalyzers(ctx, c.Repo, opReqBody.Analyzers, sessionId)
+		}
+
+		// regenerated versions inherit data of their parent, e.g. its redactions
+		if err == nil && parentId != "" {
+			_, err = readOwnedOptimization(ctx, c.Repo.OpRepo, parentId, sessionId)
+		}
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, err.Error()),
+				Code:        errConfig400.Code,
+				Message:     errConfig400.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		go c.run(context.WithoutCancel(ctx), optimizationId, parentId, sessionId, body)
+
+		w.Header().Set("HX-Trigger", "historyChanged")
 
 		return &AppResp{Component: c.ComponentBuilder.Loading(optimizationId, AnalysisState{
 			CustomCompleted:             false,
 			ContextualRichnessCompleted: false,
 			ConcisenessCompleted:        false,
 			ClarityCompleted:            false,
-			ConsistencyCompleted:        false}),
+			ConsistencyCompleted:        false,
+			LintCompleted:               false,
+			SecurityCompleted:           false,
+			Custom:                      analyzerProgress(custom)}),
 			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
-	default:
-		errConfig := get405()
-		err := errors.New("method not allowed")
-		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig.Code), errConfig.Title, errConfig.Msg),
-			Code: errConfig.Code, Message: errConfig.Msg, ContentType: "text/html", Error: err}
+	case "DELETE":
+		id := r.URL.Query().Get("id")
+
+		if id == "" {
+			err := errors.New("missing id query parameter")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		sessionId := readSession(w, r, c.Config)
+		errConfig500 := get500()
+
+		// unknown and already purged optimizations read as an empty list instead of an error
+		ops, err := c.Repo.OpRepo.ReadMany(ctx, OpReadFilter{IdCond: fmt.Sprintf("eq.%s", id)})
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		} else if len(*ops) == 0 {
+			errConfig404 := get404()
+			err = errors.New("optimization not found")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig404.Code), errConfig404.Title, errConfig404.Msg),
+				Code: errConfig404.Code, Message: errConfig404.Msg, ContentType: "text/html", Error: err}
+		}
+
+		op := &(*ops)[0]
+
+		if !ownsOptimization(*op, sessionId) {
+			errConfig403 := get403()
+			err = errors.New("optimization not owned by session")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+				Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+		}
 
+		// the versions the optimization was regenerated from are kept
+		tree, err := readSubtree(ctx, c.Repo.OpRepo, *op, 0)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		// versions other sessions branched off are not removed, purge detaches them into lineages of their own
+		var ids []string
+		for i := 0; i < len(*tree); i++ {
+			if ownsOptimization((*tree)[i], sessionId) {
+				ids = append(ids, (*tree)[i].Id)
+			}
+		}
+
+		report, err := purge(ctx, c.Repo, ids)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		logger(ctx).Info("Deleted optimization and its descendants on request", "optimization_id", id, "removed", report.String())
+
+		w.Header().Set("HX-Trigger", "historyChanged")
+
+		analyzers, err := readSessionAnalyzers(ctx, c.Repo, sessionId)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		return &AppResp{Component: c.ComponentBuilder.Draft(analyzers, !c.Config.RedactionDisabled),
+			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+	default:
+		errConfig := get405()
+		err := errors.New("method not allowed")
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig.Code), errConfig.Title, errConfig.Msg),
+			Code: errConfig.Code, Message: errConfig.Msg, ContentType: "text/html", Error: err}
+
+	}
+}
+
+type HistoryController struct {
+	ComponentBuilder *ComponentBuilder
+	Repo             *Repo
+	Config           *Config
+}
+
+func (c HistoryController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
+	switch r.Method {
+	case "GET":
+		id := r.URL.Query().Get("id")
+		current := r.URL.Query().Get("current_id")
+
+		entries, err := readHistory(ctx, c.Repo, c.Config, id, readSession(w, r, c.Config))
+
+		if errors.Is(err, errNotOwned) {
+			errConfig403 := get403()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+				Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+		} else if err != nil {
+			errConfig500 := get500()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		if current == "" {
+			current = id
+		}
+
+		return &AppResp{Component: c.ComponentBuilder.History(entries, current),
+			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+	default:
+		errConfig := get405()
+		err := errors.New("method not allowed")
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig.Code), errConfig.Title, errConfig.Msg),
+			Code: errConfig.Code, Message: errConfig.Msg, ContentType: "text/html", Error: err}
+	}
+}
+
+type ShareController struct {
+	ComponentBuilder *ComponentBuilder
+	Repo             *Repo
+	Config           *Config
+}
+
+func (c ShareController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
+	errConfig400 := get400()
+	errConfig403 := get403()
+	errConfig500 := get500()
+	sessionId := readSession(w, r, c.Config)
+
+	switch r.Method {
+	case "POST":
+		opId := r.URL.Query().Get("optimization_id")
+
+		if opId == "" {
+			err := errors.New("missing query parameter")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		op, err := c.Repo.OpRepo.Read(ctx, opId)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		if !ownsOptimization(*op, sessionId) {
+			err = errors.New("optimization not owned by session")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+				Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+		}
+
+		token, err := newShareToken()
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		share := domain.Share{
+			Id:             uuid.New().String(),
+			OptimizationId: opId,
+			TokenHash:      hashShareToken(token),
+			ExpiresAt:      time.Now().UTC().Add(time.Duration(c.Config.ShareTTLHours) * time.Hour).Format(time.RFC3339),
+			Revoked:        false}
+
+		err = c.Repo.ShareRepo.Insert(ctx, share)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		return &AppResp{Component: c.ComponentBuilder.ShareLink(ShareLink{Id: share.Id, Url: shareUrl(r, token), ExpiresAt: share.ExpiresAt}),
+			Code: 201, Message: "Created", ContentType: "text/html", Error: nil}
+	case "DELETE":
+		id := r.URL.Query().Get("id")
+
+		if id == "" {
+			err := errors.New("missing query parameter")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		share, err := c.Repo.ShareRepo.Read(ctx, id)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		op, err := c.Repo.OpRepo.Read(ctx, share.OptimizationId)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		if !ownsOptimization(*op, sessionId) {
+			err = errors.New("optimization not owned by session")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+				Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+		}
+
+		err = c.Repo.ShareRepo.Revoke(ctx, id)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		return &AppResp{Component: c.ComponentBuilder.ShareLink(ShareLink{Id: id, ExpiresAt: share.ExpiresAt, Revoked: true}),
+			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+	default:
+		errConfig := get405()
+		err := errors.New("method not allowed")
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig.Code), errConfig.Title, errConfig.Msg),
+			Code: errConfig.Code, Message: errConfig.Msg, ContentType: "text/html", Error: err}
+	}
+}
+
+type SharedController struct {
+	ComponentBuilder *ComponentBuilder
+	Repo             *Repo
+	Config           *Config
+}
+
+func (c SharedController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
+	switch r.Method {
+	case "GET":
+		token := strings.TrimPrefix(r.URL.Path, "/o/")
+
+		share, err := c.Repo.ShareRepo.ReadByToken(ctx, hashShareToken(token))
+
+		if err != nil || !shareActive(*share) {
+			errConfig404 := get404()
+			if err == nil {
+				err = errors.New("inactive share")
+			}
+			return &AppResp{Component: c.ComponentBuilder.Shared(nil, nil, nil),
+				Code: errConfig404.Code, Message: errConfig404.Msg, ContentType: "text/html", Error: err}
+		}
+
+		errConfig500 := get500()
+
+		op, err := c.Repo.OpRepo.Read(ctx, share.OptimizationId)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Shared(nil, nil, nil),
+				Code: errConfig500.Code, Message: errConfig500.Msg, ContentType: "text/html", Error: err}
+		}
+
+		suggs, err := c.Repo.SuggRepo.Read(ctx, SuggReadFilter{OpIdCond: fmt.Sprintf("eq.%s", op.Id)})
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Shared(nil, nil, nil),
+				Code: errConfig500.Code, Message: errConfig500.Msg, ContentType: "text/html", Error: err}
+		}
+
+		SuggView{Sort: "severity"}.sort(*suggs)
+
+		custom, err := readCustomAnalyzers(ctx, c.Repo, op.Analyzers)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Shared(nil, nil, nil),
+				Code: errConfig500.Code, Message: errConfig500.Msg, ContentType: "text/html", Error: err}
+		}
+
+		return &AppResp{Component: c.ComponentBuilder.Shared(op, suggs, analyzerLabels(custom)),
+			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+	default:
+		errConfig := get405()
+		err := errors.New("method not allowed")
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig.Code), errConfig.Title, errConfig.Msg),
+			Code: errConfig.Code, Message: errConfig.Msg, ContentType: "text/html", Error: err}
+	}
+}
+
+type EvaluationController struct {
+	ComponentBuilder *ComponentBuilder
+	Repo             *Repo
+	Config           *Config
+}
+
+func (c EvaluationController) readOwnedOp(ctx context.Context, id string, sessionId string) (*domain.Optimization, *AppResp) {
+	op, err := c.Repo.OpRepo.Read(ctx, id)
+
+	if err != nil {
+		errConfig500 := get500()
+		return nil, &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+			Code:        errConfig500.Code,
+			Message:     errConfig500.Msg,
+			ContentType: "text/html",
+			Error:       err}
+	}
+
+	if !ownsOptimization(*op, sessionId) {
+		errConfig403 := get403()
+		err = errors.New("optimization not owned by session")
+		return nil, &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+			Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+	}
+
+	return op, nil
+}
+
+func (c EvaluationController) form(ctx context.Context, form EvaluationForm, code int, err error) *AppResp {
+	past, readErr := c.Repo.EvalRepo.ReadMany(ctx, fmt.Sprintf("eq.%s", form.OptimizationId))
+
+	if readErr != nil {
+		errConfig500 := get500()
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+			Code:        errConfig500.Code,
+			Message:     errConfig500.Msg,
+			ContentType: "text/html",
+			Error:       readErr}
+	}
+
+	form.Past = *past
+	form.Models = evalModels
+
+	return &AppResp{Component: c.ComponentBuilder.EvaluationForm(form),
+		Code: code, Message: http.StatusText(code), ContentType: "text/html", Error: err}
+}
+
+func (c EvaluationController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
+	errConfig400 := get400()
+	errConfig500 := get500()
+	sessionId := readSession(w, r, c.Config)
+
+	id := r.URL.Query().Get("id")
+	opId := r.URL.Query().Get("optimization_id")
+
+	switch r.Method {
+	case "GET":
+		if opId != "" {
+			if _, resp := c.readOwnedOp(ctx, opId, sessionId); resp != nil {
+				return resp
+			}
+
+			return c.form(ctx, EvaluationForm{OptimizationId: opId, Model: c.Config.EvalModel, Judge: "llm"}, 200, nil)
+		}
+
+		if id == "" {
+			err := errors.New("missing query parameter")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		evaluation, err := c.Repo.EvalRepo.Read(ctx, id)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		if evaluation.SessionId != sessionId {
+			errConfig403 := get403()
+			err = errors.New("evaluation not owned by session")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+				Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+		}
+
+		view, err := readEvaluationView(ctx, c.Repo, c.Config, *evaluation)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		return &AppResp{Component: c.ComponentBuilder.Evaluation(*view),
+			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+	case "POST":
+		if opId == "" {
+			err := errors.New("missing optimization_id query parameter")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		op, resp := c.readOwnedOp(ctx, opId, sessionId)
+
+		if resp != nil {
+			return resp
+		}
+
+		body, err := Read(r.Body)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code:        errConfig400.Code,
+				Message:     errConfig400.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		req, err := ReadJSON[evaluationReq](body)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code:        errConfig400.Code,
+				Message:     errConfig400.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		form := EvaluationForm{OptimizationId: opId, Inputs: req.Inputs, Assertions: req.Assertions, Model: req.Model, Judge: req.Judge}
+
+		if op.State != "completed" {
+			err = errors.New("optimization is not completed")
+			form.ErrMsg = "The optimization has to be completed before it can be evaluated."
+			return c.form(ctx, form, errConfig400.Code, err)
+		}
+
+		var evaluation *domain.Evaluation
+		var inputs []string
+		if r.URL.Query().Get("red_team") == "true" {
+			evaluation, inputs, err = redTeamEvaluation(*op, sessionId, req.Model)
+		} else {
+			evaluation, inputs, err = req.evaluation(*op, sessionId)
+		}
+
+		if err != nil {
+			form.ErrMsg = err.Error()
+			return c.form(ctx, form, errConfig400.Code, err)
+		}
+
+		// sample inputs are redacted like the prompts before they are stored or sent to a model
+		*evaluation, inputs, err = redactEvaluation(c.Config, *op, *evaluation, inputs)
+
+		if err != nil {
+			errConfig500 := get500()
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		err = c.Repo.EvalRepo.Insert(ctx, *evaluation)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		go runEvaluation(context.WithoutCancel(ctx), c.Repo, c.Config, *evaluation, *op, inputs)
+
+		return &AppResp{Component: c.ComponentBuilder.Evaluation(EvaluationView{Evaluation: *evaluation, Cases: []domain.EvaluationCase{}}),
+			Code: 201, Message: "Created", ContentType: "text/html", Error: nil}
+	default:
+		errConfig := get405()
+		err := errors.New("method not allowed")
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig.Code), errConfig.Title, errConfig.Msg),
+			Code: errConfig.Code, Message: errConfig.Msg, ContentType: "text/html", Error: err}
+	}
+}
+
+type AutoRunController struct {
+	ComponentBuilder *ComponentBuilder
+	Repo             *Repo
+	Config           *Config
+}
+
+func (c AutoRunController) readOwnedOp(ctx context.Context, id string, sessionId string) (*domain.Optimization, *AppResp) {
+	op, err := c.Repo.OpRepo.Read(ctx, id)
+
+	if err != nil {
+		errConfig500 := get500()
+		return nil, &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+			Code:        errConfig500.Code,
+			Message:     errConfig500.Msg,
+			ContentType: "text/html",
+			Error:       err}
+	}
+
+	if !ownsOptimization(*op, sessionId) {
+		errConfig403 := get403()
+		err = errors.New("optimization not owned by session")
+		return nil, &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+			Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+	}
+
+	return op, nil
+}
+
+func (c AutoRunController) form(ctx context.Context, form AutoRunForm, code int, err error) *AppResp {
+	past, readErr := c.Repo.AutoRunRepo.ReadMany(ctx, fmt.Sprintf("eq.%s", form.OptimizationId))
+
+	if readErr != nil {
+		errConfig500 := get500()
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+			Code:        errConfig500.Code,
+			Message:     errConfig500.Msg,
+			ContentType: "text/html",
+			Error:       readErr}
+	}
+
+	form.Past = *past
+
+	return &AppResp{Component: c.ComponentBuilder.AutoRunForm(form),
+		Code: code, Message: http.StatusText(code), ContentType: "text/html", Error: err}
+}
+
+func (c AutoRunController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
+	errConfig400 := get400()
+	errConfig500 := get500()
+	sessionId := readSession(w, r, c.Config)
+
+	id := r.URL.Query().Get("id")
+	opId := r.URL.Query().Get("optimization_id")
+
+	switch r.Method {
+	case "GET":
+		if opId != "" {
+			if _, resp := c.readOwnedOp(ctx, opId, sessionId); resp != nil {
+				return resp
+			}
+
+			return c.form(ctx, AutoRunForm{OptimizationId: opId, TargetScore: defaultAutoTargetScore,
+				MaxIterations: defaultAutoMaxIterations, MaxSpend: defaultAutoMaxSpend}, 200, nil)
+		}
+
+		if id == "" {
+			err := errors.New("missing query parameter")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		run, err := c.Repo.AutoRunRepo.Read(ctx, id)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		if run.SessionId != sessionId {
+			errConfig403 := get403()
+			err = errors.New("auto run not owned by session")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+				Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+		}
+
+		view, err := readAutoRunView(ctx, c.Repo, *run)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		if view.Finished() {
+			w.Header().Set("HX-Trigger", "historyChanged")
+		}
+
+		return &AppResp{Component: c.ComponentBuilder.AutoRun(*view),
+			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+	case "POST":
+		if opId == "" {
+			err := errors.New("missing optimization_id query parameter")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		op, resp := c.readOwnedOp(ctx, opId, sessionId)
+
+		if resp != nil {
+			return resp
+		}
+
+		body, err := Read(r.Body)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code:        errConfig400.Code,
+				Message:     errConfig400.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		req, err := ReadJSON[autoRunReq](body)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code:        errConfig400.Code,
+				Message:     errConfig400.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		form := AutoRunForm{OptimizationId: opId, TargetScore: float64(req.TargetScore), MaxIterations: int(req.MaxIterations),
+			MaxSpend: int(req.MaxSpend)}
+
+		if op.State != "completed" {
+			err = errors.New("optimization is not completed")
+			form.ErrMsg = "The optimization has to be completed before it can be optimized automatically."
+			return c.form(ctx, form, errConfig400.Code, err)
+		}
+
+		run, err := req.autoRun(*op, sessionId)
+
+		if err != nil {
+			form.ErrMsg = err.Error()
+			return c.form(ctx, form, errConfig400.Code, err)
+		}
+
+		err = c.Repo.AutoRunRepo.Insert(ctx, *run)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		optimizer := OptimizationController{ComponentBuilder: c.ComponentBuilder, Repo: c.Repo, Config: c.Config}
+		go optimizer.autoOptimize(context.WithoutCancel(ctx), *run, *op)
+
+		return &AppResp{Component: c.ComponentBuilder.AutoRun(AutoRunView{Run: *run,
+			Iterations: []AutoIteration{{Optimization: *op, Position: 0, Best: true}}}),
+			Code: 201, Message: "Created", ContentType: "text/html", Error: nil}
+	default:
+		errConfig := get405()
+		err := errors.New("method not allowed")
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig.Code), errConfig.Title, errConfig.Msg),
+			Code: errConfig.Code, Message: errConfig.Msg, ContentType: "text/html", Error: err}
+	}
+}
+
+type SearchController struct {
+	ComponentBuilder *ComponentBuilder
+	Repo             *Repo
+	Config           *Config
+}
+
+func (c SearchController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
+	switch r.Method {
+	case "GET":
+		view := readSearchView(r)
+
+		if !view.Empty() && view.ErrMsg == "" {
+			results, err := search(ctx, c.Repo, c.Config, readSession(w, r, c.Config), view)
+
+			if err != nil {
+				errConfig500 := get500()
+				return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+					Code:        errConfig500.Code,
+					Message:     errConfig500.Msg,
+					ContentType: "text/html",
+					Error:       err}
+			}
+
+			view.Results = results
+		}
+
+		// the search form requests only the results, so the input it is typed into keeps focus
+		if r.URL.Query().Get("partial") == "true" {
+			return &AppResp{Component: c.ComponentBuilder.SearchResults(view),
+				Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+		}
+
+		return &AppResp{Component: c.ComponentBuilder.Search(view),
+			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+	default:
+		errConfig := get405()
+		err := errors.New("method not allowed")
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig.Code), errConfig.Title, errConfig.Msg),
+			Code: errConfig.Code, Message: errConfig.Msg, ContentType: "text/html", Error: err}
+	}
+}
+
+type LibraryController struct {
+	ComponentBuilder *ComponentBuilder
+	Repo             *Repo
+	Config           *Config
+}
+
+func (c LibraryController) readOwned(ctx context.Context, id string, sessionId string) (*domain.LibraryPrompt, *AppResp) {
+	prompt, err := c.Repo.LibRepo.Read(ctx, id)
+
+	if err != nil {
+		errConfig500 := get500()
+		return nil, &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+			Code:        errConfig500.Code,
+			Message:     errConfig500.Msg,
+			ContentType: "text/html",
+			Error:       err}
+	}
+
+	if !ownsLibraryPrompt(*prompt, sessionId) {
+		errConfig403 := get403()
+		err = errors.New("library prompt not owned by session")
+		return nil, &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+			Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+	}
+
+	return prompt, nil
+}
+
+func (c LibraryController) detail(ctx context.Context, prompt domain.LibraryPrompt, code int) *AppResp {
+	detail, err := readLibraryDetail(ctx, c.Repo, c.Config, prompt)
+
+	if err != nil {
+		errConfig500 := get500()
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+			Code:        errConfig500.Code,
+			Message:     errConfig500.Msg,
+			ContentType: "text/html",
+			Error:       err}
+	}
+
+	return &AppResp{Component: c.ComponentBuilder.LibraryPrompt(*detail),
+		Code: code, Message: http.StatusText(code), ContentType: "text/html", Error: nil}
+}
+
+func (c LibraryController) list(ctx context.Context, sessionId string, tag string) *AppResp {
+	view, err := readLibrary(ctx, c.Repo, sessionId, tag)
+
+	if err != nil {
+		errConfig500 := get500()
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+			Code:        errConfig500.Code,
+			Message:     errConfig500.Msg,
+			ContentType: "text/html",
+			Error:       err}
+	}
+
+	return &AppResp{Component: c.ComponentBuilder.Library(*view),
+		Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+}
+
+func (c LibraryController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
+	errConfig400 := get400()
+	errConfig403 := get403()
+	errConfig500 := get500()
+	sessionId := readSession(w, r, c.Config)
+
+	id := r.URL.Query().Get("id")
+	opId := r.URL.Query().Get("optimization_id")
+
+	switch r.Method {
+	case "GET":
+		if opId != "" {
+			op, err := c.Repo.OpRepo.Read(ctx, opId)
+
+			if err != nil {
+				return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+					Code:        errConfig500.Code,
+					Message:     errConfig500.Msg,
+					ContentType: "text/html",
+					Error:       err}
+			}
+
+			if !ownsOptimization(*op, sessionId) {
+				err = errors.New("optimization not owned by session")
+				return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+					Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+			}
+
+			existing, err := c.Repo.LibRepo.ReadMany(ctx, LibReadFilter{OwnerCond: fmt.Sprintf("eq.%s", sessionId)})
+
+			if err != nil {
+				return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+					Code:        errConfig500.Code,
+					Message:     errConfig500.Msg,
+					ContentType: "text/html",
+					Error:       err}
+			}
+
+			return &AppResp{Component: c.ComponentBuilder.LibraryForm(LibraryForm{OptimizationId: opId, Existing: *existing}),
+				Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+		}
+
+		if id == "" {
+			return c.list(ctx, sessionId, r.URL.Query().Get("tag"))
+		}
+
+		prompt, resp := c.readOwned(ctx, id, sessionId)
+
+		if resp != nil {
+			return resp
+		}
+
+		if r.URL.Query().Get("form") == "edit" {
+			return &AppResp{Component: c.ComponentBuilder.LibraryForm(LibraryForm{Prompt: *prompt}),
+				Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+		}
+
+		return c.detail(ctx, *prompt, 200)
+	case "POST":
+		body, err := Read(r.Body)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code:        errConfig400.Code,
+				Message:     errConfig400.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		req, err := ReadJSON[libraryPromptReq](body)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code:        errConfig400.Code,
+				Message:     errConfig400.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		if opId != "" {
+			op, err := c.Repo.OpRepo.Read(ctx, opId)
+
+			if err != nil {
+				return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+					Code:        errConfig500.Code,
+					Message:     errConfig500.Msg,
+					ContentType: "text/html",
+					Error:       err}
+			}
+
+			if !ownsOptimization(*op, sessionId) {
+				err = errors.New("optimization not owned by session")
+				return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+					Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+			}
+		}
+
+		var prompt *domain.LibraryPrompt
+		code := 200
+
+		if req.LibraryPromptId != "" {
+			var resp *AppResp
+			prompt, resp = c.readOwned(ctx, req.LibraryPromptId, sessionId)
+
+			if resp != nil {
+				return resp
+			}
+		} else {
+			if err = req.validate(); err != nil {
+				return &AppResp{Component: c.ComponentBuilder.LibraryForm(LibraryForm{OptimizationId: opId, ErrMsg: err.Error()}),
+					Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+			}
+
+			prompt = &domain.LibraryPrompt{
+				Id:          uuid.New().String(),
+				Name:        strings.TrimSpace(req.Name),
+				Description: strings.TrimSpace(req.Description),
+				Tags:        parseTags(req.Tags),
+				Owner:       sessionId}
+
+			err = c.Repo.LibRepo.Insert(ctx, *prompt)
+
+			if err != nil {
+				return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+					Code:        errConfig500.Code,
+					Message:     errConfig500.Msg,
+					ContentType: "text/html",
+					Error:       err}
+			}
+
+			code = 201
+		}
+
+		if opId != "" {
+			err = c.Repo.OpRepo.Link(ctx, opId, prompt.Id)
+
+			if err != nil {
+				return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+					Code:        errConfig500.Code,
+					Message:     errConfig500.Msg,
+					ContentType: "text/html",
+					Error:       err}
+			}
+		}
+
+		return c.detail(ctx, *prompt, code)
+	case "PATCH":
+		if id == "" {
+			err := errors.New("missing id query parameter")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		prompt, resp := c.readOwned(ctx, id, sessionId)
+
+		if resp != nil {
+			return resp
+		}
+
+		body, err := Read(r.Body)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code:        errConfig400.Code,
+				Message:     errConfig400.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		req, err := ReadJSON[libraryPromptReq](body)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code:        errConfig400.Code,
+				Message:     errConfig400.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		if err = req.validate(); err != nil {
+			return &AppResp{Component: c.ComponentBuilder.LibraryForm(LibraryForm{Prompt: *prompt, ErrMsg: err.Error()}),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		opts := LibUpdateOpts{Name: strings.TrimSpace(req.Name), Description: strings.TrimSpace(req.Description), Tags: parseTags(req.Tags)}
+
+		err = c.Repo.LibRepo.Update(ctx, id, opts)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		prompt.Name = opts.Name
+		prompt.Description = opts.Description
+		prompt.Tags = opts.Tags
+
+		return c.detail(ctx, *prompt, 200)
+	case "DELETE":
+		if id == "" {
+			err := errors.New("missing id query parameter")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		_, resp := c.readOwned(ctx, id, sessionId)
+
+		if resp != nil {
+			return resp
+		}
+
+		// versions are kept as regular optimizations after their library prompt is gone
+		err := c.Repo.OpRepo.Unlink(ctx, id)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		err = c.Repo.LibRepo.Delete(ctx, id)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		return c.list(ctx, sessionId, "")
+	default:
+		errConfig := get405()
+		err := errors.New("method not allowed")
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig.Code), errConfig.Title, errConfig.Msg),
+			Code: errConfig.Code, Message: errConfig.Msg, ContentType: "text/html", Error: err}
+	}
+}
+
+type BatchController struct {
+	ComponentBuilder *ComponentBuilder
+	Repo             *Repo
+	Config           *Config
+}
+
+func (c BatchController) process(ctx context.Context, batch domain.Batch, items []batchItem) {
+	ctx = withLog(ctx, "batch_id", batch.Id)
+	optimizer := OptimizationController{ComponentBuilder: c.ComponentBuilder, Repo: c.Repo, Config: c.Config}
+
+	concurrency := c.Config.BatchConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for i := 0; i < len(items); i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(item batchItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			opId := uuid.New().String()
+
+			err := c.Repo.PHRepo.Capture(ctx, fmt.Sprintf("%s_batch_generated", c.Config.Env), opId)
+			if err != nil {
+				logger(ctx).Error("Capturing batch event failed", "error", err)
+			}
+
+			optimizer.start(withLog(ctx, "optimization_id", opId), domain.Optimization{
+				Id:              opId,
+				OriginalPrompt:  item.Prompt,
+				Instructions:    item.Instructions,
+				SessionId:       batch.SessionId,
+				BatchId:         batch.Id,
+				ExternalId:      item.Id,
+				OptimizedPrompt: "",
+				State:           "pending"})
+		}(items[i])
+	}
+
+	wg.Wait()
+
+	err := c.Repo.BatchRepo.Update(ctx, batch.Id, "completed")
+
+	if err != nil {
+		logger(ctx).Error("Completing batch failed", "error", err)
+		return
+	}
+
+	logger(ctx).Info("Finished batch", "prompts", len(items))
+}
+
+func (c BatchController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
+	errConfig400 := get400()
+	errConfig500 := get500()
+	sessionId := readSession(w, r, c.Config)
+
+	switch r.Method {
+	case "GET":
+		id := r.URL.Query().Get("id")
+		format := r.URL.Query().Get("format")
+
+		if id == "" {
+			return &AppResp{Component: c.ComponentBuilder.BatchUpload(""),
+				Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+		}
+
+		batch, err := c.Repo.BatchRepo.Read(ctx, id)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		if batch.SessionId != sessionId {
+			errConfig403 := get403()
+			err = errors.New("batch not owned by session")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+				Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+		}
+
+		results, err := readBatchResults(ctx, c.Repo, c.Config, id)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		var content []byte
+		var contentType string
+
+		switch format {
+		case "":
+			progress := BatchProgress{Batch: *batch}
+			for i := 0; i < len(results); i++ {
+				switch results[i].State {
+				case "completed":
+					progress.Completed++
+				case "failed":
+					progress.Failed++
+				}
+			}
+			// prompts that couldn't even be stored have no state, they failed once the batch is finished
+			if progress.Finished() {
+				progress.Failed = batch.Total - progress.Completed
+			}
+			progress.Pending = batch.Total - progress.Completed - progress.Failed
+
+			return &AppResp{Component: c.ComponentBuilder.BatchProgress(progress),
+				Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+		case "csv":
+			content, err = batchResultsCSV(results)
+			contentType = "text/csv; charset=utf-8"
+		case "jsonl":
+			content, err = batchResultsJSONL(results)
+			contentType = "application/x-ndjson"
+		default:
+			err = errors.New("invalid format query parameter")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="batch-%s.%s"`, id, format))
+
+		return &AppResp{Component: rawComponent(content),
+			Code: 200, Message: "OK", ContentType: contentType, Error: nil}
+	case "POST":
+		r.Body = http.MaxBytesReader(w, r.Body, maxBatchUploadSize)
+
+		file, header, err := r.FormFile("file")
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.BatchUpload("Please select a CSV or JSONL file of at most 5 MB."),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		content, err := Read(file)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.BatchUpload("The uploaded file could not be read."),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		items, err := parseBatch(header.Filename, content)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.BatchUpload(fmt.Sprintf("The uploaded file is invalid: %s", err.Error())),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		batch := domain.Batch{Id: uuid.New().String(), SessionId: sessionId, State: "running", Total: len(items)}
+
+		err = c.Repo.BatchRepo.Insert(ctx, batch)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		go c.process(context.WithoutCancel(ctx), batch, items)
+
+		w.Header().Set("HX-Trigger", "historyChanged")
+
+		return &AppResp{Component: c.ComponentBuilder.BatchProgress(BatchProgress{Batch: batch, Pending: batch.Total}),
+			Code: 201, Message: "Created", ContentType: "text/html", Error: nil}
+	default:
+		errConfig := get405()
+		err := errors.New("method not allowed")
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig.Code), errConfig.Title, errConfig.Msg),
+			Code: errConfig.Code, Message: errConfig.Msg, ContentType: "text/html", Error: err}
+	}
+}
+
+const reportStylesheet = "static/style/index_transpiled.css"
+
+type ExportController struct {
+	ComponentBuilder *ComponentBuilder
+	Repo             *Repo
+	Config           *Config
+}
+
+func (c ExportController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
+	errConfig400 := get400()
+	errConfig500 := get500()
+
+	switch r.Method {
+	case "GET":
+		opId := r.URL.Query().Get("optimization_id")
+		format := r.URL.Query().Get("format")
+
+		if opId == "" || (format != "md" && format != "html" && format != "json") {
+			err := errors.New("missing or invalid query parameter")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig400.Code), errConfig400.Title, errConfig400.Msg),
+				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
+		}
+
+		op, err := c.Repo.OpRepo.Read(ctx, opId)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		if !ownsOptimization(*op, readSession(w, r, c.Config)) {
+			errConfig403 := get403()
+			err = errors.New("optimization not owned by session")
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig403.Code), errConfig403.Title, errConfig403.Msg),
+				Code: errConfig403.Code, Message: errConfig403.Msg, ContentType: "text/html", Error: err}
+		}
+
+		report, err := readReport(ctx, c.Repo, c.Config, *op)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="optimization-%s.%s"`, op.Id, format))
+
+		switch format {
+		case "md":
+			return &AppResp{Component: rawComponent(report.markdown()),
+				Code: 200, Message: "OK", ContentType: "text/markdown; charset=utf-8", Error: nil}
+		case "json":
+			content, err := report.json()
+
+			if err != nil {
+				w.Header().Del("Content-Disposition")
+				return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+					Code:        errConfig500.Code,
+					Message:     errConfig500.Msg,
+					ContentType: "text/html",
+					Error:       err}
+			}
+
+			return &AppResp{Component: rawComponent(content),
+				Code: 200, Message: "OK", ContentType: "application/json", Error: nil}
+		default:
+			// the stylesheet is inlined, so the report renders without the server
+			css, err := os.ReadFile(reportStylesheet)
+
+			if err != nil {
+				logger(ctx).Warn("Could not inline report stylesheet", "error", err)
+			}
+
+			return &AppResp{Component: c.ComponentBuilder.Report(*report, string(css)),
+				Code: 200, Message: "OK", ContentType: "text/html; charset=utf-8", Error: nil}
+		}
+	default:
+		errConfig := get405()
+		err := errors.New("method not allowed")
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig.Code), errConfig.Title, errConfig.Msg),
+			Code: errConfig.Code, Message: errConfig.Msg, ContentType: "text/html", Error: err}
+	}
+}
+
+type ProfileController struct {
+	ComponentBuilder *ComponentBuilder
+	Repo             *Repo
+	Config           *Config
+}
+
+func (c ProfileController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
+	sessionId := readSession(w, r, c.Config)
+	errConfig500 := get500()
+
+	switch r.Method {
+	case "GET":
+		profile, err := readPreferenceProfile(ctx, c.Repo, sessionId)
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		return &AppResp{Component: c.ComponentBuilder.Profile(*profile),
+			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+	case "DELETE":
+		resetAt := time.Now().UTC().Format(time.RFC3339)
+
+		err := c.Repo.ProfRepo.Upsert(ctx, domain.Profile{SessionId: sessionId, ResetAt: resetAt})
+
+		if err != nil {
+			return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig500.Code), errConfig500.Title, errConfig500.Msg),
+				Code:        errConfig500.Code,
+				Message:     errConfig500.Msg,
+				ContentType: "text/html",
+				Error:       err}
+		}
+
+		return &AppResp{Component: c.ComponentBuilder.Profile(PreferenceProfile{SessionId: sessionId, ResetAt: resetAt}),
+			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
+	default:
+		errConfig := get405()
+		err := errors.New("method not allowed")
+		return &AppResp{Component: c.ComponentBuilder.Error(strconv.Itoa(errConfig.Code), errConfig.Title, errConfig.Msg),
+			Code: errConfig.Code, Message: errConfig.Msg, ContentType: "text/html", Error: err}
 	}
 }
 
-func (c CaptureController) capture(eventType string, opId string) {
-	err := c.Repo.PHRepo.Capture(fmt.Sprintf("%s_%s", c.Config.Env, eventType), opId)
+func (c CaptureController) capture(ctx context.Context, eventType string, opId string) {
+	err := c.Repo.PHRepo.Capture(ctx, fmt.Sprintf("%s_%s", c.Config.Env, eventType), opId)
 
 	if err != nil {
-		slog.Error(fmt.Sprintf("Error occured: %s", err.Error()))
+		logger(ctx).Error("Capturing event failed", "error", err)
 	}
 
 }
@@ -758,6 +2929,7 @@ type CaptureController struct {
 }
 
 func (c CaptureController) Handle(w http.ResponseWriter, r *http.Request) *AppResp {
+	ctx := r.Context()
 	errConfig400 := get400()
 
 	switch r.Method {
@@ -771,7 +2943,7 @@ func (c CaptureController) Handle(w http.ResponseWriter, r *http.Request) *AppRe
 				Code: errConfig400.Code, Message: errConfig400.Msg, ContentType: "text/html", Error: err}
 		}
 
-		go c.capture(eventType, opId)
+		go c.capture(context.WithoutCancel(ctx), eventType, opId)
 
 		return &AppResp{Component: nil,
 			Code: 200, Message: "OK", ContentType: "text/html", Error: nil}
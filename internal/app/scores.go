@@ -0,0 +1,242 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+const scoreInstruct = `
+		Also score how well the model instructions do in the evaluated dimension with a 'score' between 0 and 10, where 10 leaves nothing to improve, and explain the score in a one sentence 'rationale'.
+		Respond with a JSON object of the form {"score": <score>, "rationale": "<rationale>", "suggestions": [<suggestions>]}.
+		`
+
+// oaiAnalysis is the output of an analyzer. Analyzers that don't score return the suggestions only.
+type oaiAnalysis struct {
+	Score       *float64        `json:"score"`
+	Rationale   string          `json:"rationale"`
+	Suggestions []oaiSuggestion `json:"suggestions"`
+}
+
+type oaiScore struct {
+	Score     *float64 `json:"score"`
+	Rationale string   `json:"rationale"`
+}
+
+func parseAnalysis(msg []byte) (*oaiAnalysis, error) {
+	if strings.HasPrefix(strings.TrimSpace(string(msg)), "[") {
+		suggestions, err := ReadJSON[[]oaiSuggestion](msg)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &oaiAnalysis{Suggestions: *suggestions}, nil
+	}
+
+	return ReadJSON[oaiAnalysis](msg)
+}
+
+func normalizeScore(score float64) int16 {
+	return int16(math.Round(math.Max(0, math.Min(10, score))))
+}
+
+// genScoreUserPrompt scores the prompt in the dimension, or against the custom goal if there is one
+func genScoreUserPrompt(dimension string, customGoal string, prompt string, protected string) string {
+	goal := fmt.Sprintf("the %s of the following \"Model Instructions\"", strings.Join(strings.Split(dimension, "_"), " "))
+	if customGoal != "" {
+		goal = fmt.Sprintf("the following \"Model Instructions\" against the \"Custom Goal\":\n\n\t\t%s\n", customGoal)
+	}
+
+	return fmt.Sprintf(
+		`Score %s with a 'score' between 0 and 10, where 10 leaves nothing to improve, and explain the score in a one sentence 'rationale'.
+		Don't make suggestions. Respond with a JSON object of the form {"score": <score>, "rationale": "<rationale>"}.
+
+		Model Instructions:
+
+		%s
+
+		%s
+		`, goal, prompt, protected)
+}
+
+// rescore has every analyzer that scored the original prompt score the optimized prompt as well
+func (c OptimizationController) rescore(ctx context.Context, opId string, base optimizationBase, optimized string) {
+	runs, err := c.Repo.RunRepo.Read(ctx, RunReadFilter{OptimizationId: opId})
+
+	if err != nil {
+		logger(ctx).Error("Reading runs for rescoring failed", "error", err)
+		return
+	}
+
+	optimizedBase := optimizationBase{Prompt: optimized, Instructions: base.Instructions}
+	if messages, ok := parseChatPrompt(optimized); ok {
+		optimizedBase.Messages = messages
+	}
+
+	assistants := base.assistants()
+
+	var wg sync.WaitGroup
+	for i := 0; i < len(*runs); i++ {
+		run := (*runs)[i]
+		analyzer, ok := findAssistant(run.Type, assistants)
+		if run.Score == nil || !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(ctx context.Context) {
+			defer wg.Done()
+
+			userPrompt := genScoreUserPrompt(analyzer.Name, analyzer.goal(base), optimizedBase.analyzerCtx(), variablesCtx(base.Variables))
+
+			thId, err := c.Repo.OAIRepo.PostThread(ctx)
+
+			if err != nil {
+				logger(ctx).Error("Creating thread failed", "error", err)
+				return
+			}
+
+			defer func() {
+				err = c.Repo.OAIRepo.DeleteThread(ctx, thId)
+				if err != nil {
+					logger(ctx).Error("Deleting thread failed", "error", err)
+				}
+			}()
+
+			msg, err := c.runAssistant(ctx, thId, userPrompt, analyzer, base.Usage)
+
+			if err != nil {
+				logger(ctx).Error("Rescoring failed", "error", err)
+				return
+			}
+
+			score, err := ReadJSON[oaiScore](msg)
+
+			if err != nil || score.Score == nil {
+				logger(ctx).Warn("Assistant produced an unparseable score, ignoring score")
+				return
+			}
+
+			optimizedScore := normalizeScore(*score.Score)
+			err = c.Repo.RunRepo.UpdateScores(ctx, run.Id, RunScoreOpts{OptimizedScore: &optimizedScore, OptimizedRationale: score.Rationale})
+
+			if err != nil {
+				logger(ctx).Error("Storing optimized score failed", "error", err)
+			}
+		}(withLog(ctx, "analyzer", analyzer.Name, "run_id", run.Id))
+	}
+
+	wg.Wait()
+}
+
+func findAnalyzer(name string) (assistant, bool) {
+	return findAssistant(name, analyzers)
+}
+
+func findAssistant(name string, assistants []assistant) (assistant, bool) {
+	for i := 0; i < len(assistants); i++ {
+		if assistants[i].Name == name {
+			return assistants[i], true
+		}
+	}
+
+	return assistant{}, false
+}
+
+// ScoreEntry compares the scores an analyzer gave the original and the optimized prompt
+type ScoreEntry struct {
+	Dimension string
+	// Label is set for custom analyzers
+	Label              string
+	Score              *int16
+	Rationale          string
+	OptimizedScore     *int16
+	OptimizedRationale string
+}
+
+// Delta is the change of the score, 0 if either score is missing
+func (e ScoreEntry) Delta() int16 {
+	if e.Score == nil || e.OptimizedScore == nil {
+		return 0
+	}
+
+	return *e.OptimizedScore - *e.Score
+}
+
+type Scorecard []ScoreEntry
+
+func average(scores []int16) (float64, bool) {
+	if len(scores) == 0 {
+		return 0, false
+	}
+
+	var sum float64
+	for i := 0; i < len(scores); i++ {
+		sum += float64(scores[i])
+	}
+
+	return sum / float64(len(scores)), true
+}
+
+// Averages returns the mean scores of the dimensions scored both before and after optimizing
+func (s Scorecard) Averages() (float64, float64, bool) {
+	var before, after []int16
+	for i := 0; i < len(s); i++ {
+		if s[i].Score != nil && s[i].OptimizedScore != nil {
+			before = append(before, *s[i].Score)
+			after = append(after, *s[i].OptimizedScore)
+		}
+	}
+
+	beforeAvg, ok := average(before)
+	afterAvg, _ := average(after)
+
+	return beforeAvg, afterAvg, ok
+}
+
+// readScorecard collects the scores of the optimization's runs in the order of the analyzers,
+// followed by its custom analyzers
+func readScorecard(ctx context.Context, repo *Repo, opId string) (Scorecard, error) {
+	runs, err := repo.RunRepo.Read(ctx, RunReadFilter{OptimizationId: opId})
+
+	if err != nil {
+		return nil, err
+	}
+
+	custom, err := readOpAnalyzers(ctx, repo, opId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	labels := analyzerLabels(custom)
+	names := append(dimensions(), analyzerNames(custom)...)
+
+	byType := make(map[string]domain.Run)
+	for i := 0; i < len(*runs); i++ {
+		byType[(*runs)[i].Type] = (*runs)[i]
+	}
+
+	var scorecard Scorecard
+	for i := 0; i < len(names); i++ {
+		run, ok := byType[names[i]]
+		if !ok || run.Score == nil {
+			continue
+		}
+
+		scorecard = append(scorecard, ScoreEntry{
+			Dimension:          run.Type,
+			Label:              labels[run.Type],
+			Score:              run.Score,
+			Rationale:          run.Rationale,
+			OptimizedScore:     run.OptimizedScore,
+			OptimizedRationale: run.OptimizedRationale})
+	}
+
+	return scorecard, nil
+}
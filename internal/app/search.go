@@ -0,0 +1,383 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+const (
+	searchCandidateLimit = 100
+	searchResultLimit    = 25
+	searchSuggSnippets   = 2
+	snippetRadius        = 60
+	searchDateLayout     = "2006-01-02"
+)
+
+var feedbackFilters = map[string]string{"upvoted": "eq.1", "excluded": "eq.-1", "unrated": "eq.0"}
+
+// HighlightSegment is a part of a snippet. Segments that matched a search term have Match set.
+type HighlightSegment struct {
+	Text  string
+	Match bool
+}
+
+type SearchSnippet struct {
+	Field    string
+	Segments []HighlightSegment
+}
+
+type SearchResult struct {
+	Optimization domain.Optimization
+	Score        float64
+	Snippets     []SearchSnippet
+}
+
+// SearchView holds the search query, its filters and the ranked results
+type SearchView struct {
+	Query      string
+	From       string
+	To         string
+	Dimension  string
+	Feedback   string
+	Dimensions []string
+	Results    []SearchResult
+	ErrMsg     string
+}
+
+func (v SearchView) Empty() bool {
+	return len(searchTerms(v.Query)) == 0
+}
+
+func (v SearchView) filtered() bool {
+	return v.Dimension != "" || v.Feedback != ""
+}
+
+func (v SearchView) createdAtConds() ([]string, error) {
+	var conds []string
+
+	if v.From != "" {
+		from, err := time.Parse(searchDateLayout, v.From)
+
+		if err != nil {
+			return nil, errors.New("invalid from date")
+		}
+
+		conds = append(conds, fmt.Sprintf("gte.%s", from.Format(time.RFC3339)))
+	}
+
+	if v.To != "" {
+		to, err := time.Parse(searchDateLayout, v.To)
+
+		if err != nil {
+			return nil, errors.New("invalid to date")
+		}
+
+		// the to date is inclusive
+		conds = append(conds, fmt.Sprintf("lt.%s", to.AddDate(0, 0, 1).Format(time.RFC3339)))
+	}
+
+	return conds, nil
+}
+
+func (v SearchView) suggFilter(filter SuggReadFilter) SuggReadFilter {
+	if v.Dimension != "" {
+		filter.AnalyzersCond = fmt.Sprintf("cs.{%s}", v.Dimension)
+	}
+	if v.Feedback != "" {
+		filter.UFeedbCond = feedbackFilters[v.Feedback]
+	}
+
+	return filter
+}
+
+func readSearchView(r *http.Request) SearchView {
+	query := r.URL.Query()
+
+	view := SearchView{
+		Query:      strings.TrimSpace(query.Get("q")),
+		From:       query.Get("from"),
+		To:         query.Get("to"),
+		Dimension:  query.Get("dimension"),
+		Feedback:   query.Get("feedback"),
+		Dimensions: dimensions(),
+	}
+
+	if !contains(view.Dimensions, view.Dimension) {
+		view.Dimension = ""
+	}
+	if _, ok := feedbackFilters[view.Feedback]; !ok {
+		view.Feedback = ""
+	}
+	if _, err := view.createdAtConds(); err != nil {
+		view.ErrMsg = fmt.Sprintf("Please use dates formatted as YYYY-MM-DD, %s.", err.Error())
+	}
+
+	return view
+}
+
+// searchTerms splits a query into distinct lower case words. Operators of the query syntax are
+// dropped, so terms can be passed on to the full-text search as is.
+func searchTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	var terms []string
+	for i := 0; i < len(words); i++ {
+		if !contains(terms, words[i]) {
+			terms = append(terms, words[i])
+		}
+	}
+
+	return terms
+}
+
+type termMatch struct {
+	Start int
+	End   int
+}
+
+// findTerms returns the rune offsets of all non overlapping term occurrences in text, ignoring case
+func findTerms(text []rune, terms []string) []termMatch {
+	lower := make([]rune, len(text))
+	for i := 0; i < len(text); i++ {
+		lower[i] = unicode.ToLower(text[i])
+	}
+
+	var matches []termMatch
+	for i := 0; i < len(lower); {
+		matched := 0
+		for j := 0; j < len(terms); j++ {
+			term := []rune(terms[j])
+			if len(term) > matched && i+len(term) <= len(lower) && string(lower[i:i+len(term)]) == terms[j] {
+				matched = len(term)
+			}
+		}
+
+		if matched == 0 {
+			i++
+			continue
+		}
+
+		matches = append(matches, termMatch{Start: i, End: i + matched})
+		i += matched
+	}
+
+	return matches
+}
+
+// highlight cuts a snippet around the first match of text and splits it into segments
+func highlight(text string, terms []string) []HighlightSegment {
+	runes := []rune(text)
+	matches := findTerms(runes, terms)
+
+	if len(matches) == 0 {
+		return nil
+	}
+
+	start := matches[0].Start - snippetRadius
+	if start < 0 {
+		start = 0
+	}
+	end := matches[0].End + 2*snippetRadius
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var segments []HighlightSegment
+	if start > 0 {
+		segments = append(segments, HighlightSegment{Text: "..."})
+	}
+
+	pos := start
+	for i := 0; i < len(matches) && matches[i].End <= end; i++ {
+		if matches[i].Start > pos {
+			segments = append(segments, HighlightSegment{Text: string(runes[pos:matches[i].Start])})
+		}
+		segments = append(segments, HighlightSegment{Text: string(runes[matches[i].Start:matches[i].End]), Match: true})
+		pos = matches[i].End
+	}
+
+	if pos < end {
+		segments = append(segments, HighlightSegment{Text: string(runes[pos:end])})
+	}
+	if end < len(runes) {
+		segments = append(segments, HighlightSegment{Text: "..."})
+	}
+
+	return segments
+}
+
+type searchField struct {
+	Name   string
+	Weight float64
+	Text   func(op domain.Optimization) string
+}
+
+var searchFields = []searchField{
+	{Name: "Prompt", Weight: 3, Text: func(op domain.Optimization) string { return op.OriginalPrompt }},
+	{Name: "Instructions", Weight: 2, Text: func(op domain.Optimization) string { return op.Instructions }},
+	{Name: "Optimized Prompt", Weight: 1, Text: func(op domain.Optimization) string { return op.OptimizedPrompt }},
+}
+
+// rank scores an optimization by its weighted term occurrences and the share of query terms it
+// contains. Candidates that only matched the stemmed full-text search keep a score of zero.
+func rank(op domain.Optimization, suggs []domain.Suggestion, terms []string) SearchResult {
+	result := SearchResult{Optimization: op}
+	found := make(map[string]bool)
+
+	score := func(text string, weight float64) int {
+		runes := []rune(text)
+		matches := findTerms(runes, terms)
+		for i := 0; i < len(matches); i++ {
+			found[strings.ToLower(string(runes[matches[i].Start:matches[i].End]))] = true
+		}
+		result.Score += weight * float64(len(matches))
+
+		return len(matches)
+	}
+
+	for i := 0; i < len(searchFields); i++ {
+		text := searchFields[i].Text(op)
+		if score(text, searchFields[i].Weight) > 0 {
+			result.Snippets = append(result.Snippets, SearchSnippet{Field: searchFields[i].Name, Segments: highlight(text, terms)})
+		}
+	}
+
+	snippets := 0
+	for i := 0; i < len(suggs); i++ {
+		if score(suggs[i].Suggestion, 1) > 0 && snippets < searchSuggSnippets {
+			result.Snippets = append(result.Snippets, SearchSnippet{Field: fmt.Sprintf("Suggestion · %s", suggs[i].Type),
+				Segments: highlight(suggs[i].Suggestion, terms)})
+			snippets++
+		}
+	}
+
+	result.Score *= float64(len(found)) / float64(len(terms))
+
+	return result
+}
+
+// search looks up optimizations of a session whose texts or suggestions match the query. The
+// backend full-text search selects candidates, which are then ranked and highlighted.
+func search(ctx context.Context, repo *Repo, config *Config, sessionId string, view SearchView) ([]SearchResult, error) {
+	terms := searchTerms(view.Query)
+
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	text := strings.Join(terms, " ")
+
+	conds, err := view.createdAtConds()
+
+	if err != nil {
+		return nil, err
+	}
+
+	sessionCond := fmt.Sprintf("eq.%s", sessionId)
+
+	ops, err := repo.OpRepo.ReadMany(ctx, OpReadFilter{SessionIdCond: sessionCond, CreatedAtConds: conds, SearchText: text,
+		Limit: searchCandidateLimit})
+
+	if err != nil {
+		return nil, err
+	}
+
+	suggs, err := repo.SuggRepo.Read(ctx, view.suggFilter(SuggReadFilter{SessionIdCond: sessionCond, SearchText: text,
+		Limit: searchCandidateLimit}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[string]domain.Optimization)
+	for i := 0; i < len(*ops); i++ {
+		candidates[(*ops)[i].Id] = (*ops)[i]
+	}
+
+	suggsByOp := make(map[string][]domain.Suggestion)
+	var missing []string
+	for i := 0; i < len(*suggs); i++ {
+		opId := (*suggs)[i].OptimizationId
+		if _, ok := candidates[opId]; !ok && len(suggsByOp[opId]) == 0 {
+			missing = append(missing, opId)
+		}
+		suggsByOp[opId] = append(suggsByOp[opId], (*suggs)[i])
+	}
+
+	// the date filters only apply to optimizations, so those of matching suggestions are read separately
+	if len(missing) > 0 {
+		ops, err = repo.OpRepo.ReadMany(ctx, OpReadFilter{IdCond: inCond(missing), SessionIdCond: sessionCond, CreatedAtConds: conds})
+
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < len(*ops); i++ {
+			candidates[(*ops)[i].Id] = (*ops)[i]
+		}
+	}
+
+	if len(candidates) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	var allowed map[string]bool
+	if view.filtered() {
+		ids := make([]string, 0, len(candidates))
+		for id := range candidates {
+			ids = append(ids, id)
+		}
+
+		filtered, err := repo.SuggRepo.Read(ctx, view.suggFilter(SuggReadFilter{OpIdCond: inCond(ids)}))
+
+		if err != nil {
+			return nil, err
+		}
+
+		allowed = make(map[string]bool)
+		for i := 0; i < len(*filtered); i++ {
+			allowed[(*filtered)[i].OptimizationId] = true
+		}
+	}
+
+	var results []SearchResult
+	for id, op := range candidates {
+		if allowed != nil && !allowed[id] {
+			continue
+		}
+
+		// the backend only matches redacted texts, the results show the restored ones
+		suggs := suggsByOp[id]
+		if err := restoreSuggestions(config, op, suggs); err != nil {
+			return nil, err
+		}
+		if op, err = restoreOptimization(config, op); err != nil {
+			return nil, err
+		}
+
+		results = append(results, rank(op, suggs, terms))
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Optimization.CreatedAt > results[j].Optimization.CreatedAt
+	})
+
+	if len(results) > searchResultLimit {
+		results = results[:searchResultLimit]
+	}
+
+	return results, nil
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+	"github.com/google/uuid"
+)
+
+const sessionCookie = "session_id"
+
+// readSession returns the id of the browser session, which is used to attribute optimizations
+// and feedback. A new session is started if the request doesn't carry a valid one.
+func readSession(w http.ResponseWriter, r *http.Request, config *Config) string {
+	cookie, err := r.Cookie(sessionCookie)
+
+	if err == nil {
+		if _, err = uuid.Parse(cookie.Value); err == nil {
+			return cookie.Value
+		}
+	}
+
+	id := uuid.New().String()
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		Secure:   config.Env == "prod",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return id
+}
+
+func ownsOptimization(op domain.Optimization, sessionId string) bool {
+	return op.SessionId != "" && op.SessionId == sessionId
+}
+
+var errNotOwned = errors.New("optimization not owned by session")
+
+// readOwnedOptimization reads an optimization of the session. Other sessions only get to see
+// optimizations through share links.
+func readOwnedOptimization(ctx context.Context, repo opRepo, id string, sessionId string) (*domain.Optimization, error) {
+	op, err := repo.Read(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ownsOptimization(*op, sessionId) {
+		return nil, errNotOwned
+	}
+
+	return op, nil
+}
+
+func ownsLibraryPrompt(prompt domain.LibraryPrompt, sessionId string) bool {
+	return prompt.Owner != "" && prompt.Owner == sessionId
+}
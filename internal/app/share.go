@@ -0,0 +1,59 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+// ShareLink is the view of a share that is only available to the owner of the optimization
+type ShareLink struct {
+	Id        string
+	Url       string
+	ExpiresAt string
+	Revoked   bool
+}
+
+func newShareToken() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashShareToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func shareUrl(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s/o/%s", scheme, r.Host, token)
+}
+
+func shareActive(share domain.Share) bool {
+	if share.Revoked {
+		return false
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339Nano, share.ExpiresAt)
+
+	if err != nil {
+		return false
+	}
+
+	return time.Now().Before(expiresAt)
+}
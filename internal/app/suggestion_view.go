@@ -0,0 +1,133 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+var severities = []string{"critical", "major", "minor"}
+
+// SuggView describes how the suggestion panel is sorted and filtered
+type SuggView struct {
+	OptimizationId string
+	Sort           string
+	Severity       string
+	Dimension      string
+	Dimensions     []string
+	// Labels are the display names of the custom analyzers, keyed by their type
+	Labels map[string]string
+	// TokenDeltas is by how many tokens each suggestion changes the prompt, keyed by suggestion id
+	TokenDeltas map[string]int
+}
+
+func (v SuggView) Query() string {
+	return fmt.Sprintf("sort=%s&severity=%s&dimension=%s", v.Sort, v.Severity, v.Dimension)
+}
+
+func (v SuggView) filter(filter SuggReadFilter) SuggReadFilter {
+	filter.OpIdCond = fmt.Sprintf("eq.%s", v.OptimizationId)
+
+	if v.Severity != "" {
+		filter.SeverityCond = fmt.Sprintf("eq.%s", v.Severity)
+	}
+	if v.Dimension != "" {
+		filter.AnalyzersCond = fmt.Sprintf("cs.{%s}", v.Dimension)
+	}
+
+	return filter
+}
+
+func (v SuggView) sort(suggs []domain.Suggestion) {
+	switch v.Sort {
+	case "impact":
+		sort.SliceStable(suggs, func(i, j int) bool {
+			if suggs[i].Impact != suggs[j].Impact {
+				return suggs[i].Impact > suggs[j].Impact
+			}
+			return severityRank(suggs[i].Severity) < severityRank(suggs[j].Severity)
+		})
+	case "dimension":
+		rank := make(map[string]int)
+		for i := 0; i < len(v.Dimensions); i++ {
+			rank[v.Dimensions[i]] = i
+		}
+
+		sort.SliceStable(suggs, func(i, j int) bool {
+			return rank[suggs[i].Type] < rank[suggs[j].Type]
+		})
+	default:
+		sort.SliceStable(suggs, func(i, j int) bool {
+			if severityRank(suggs[i].Severity) != severityRank(suggs[j].Severity) {
+				return severityRank(suggs[i].Severity) < severityRank(suggs[j].Severity)
+			}
+			return suggs[i].Impact > suggs[j].Impact
+		})
+	}
+}
+
+// readSuggView reads the view from the query. The custom analyzers of the optimization are
+// offered as additional dimensions.
+func readSuggView(r *http.Request, custom []domain.CustomAnalyzer) SuggView {
+	query := r.URL.Query()
+
+	view := SuggView{
+		OptimizationId: query.Get("op_id"),
+		Sort:           query.Get("sort"),
+		Severity:       query.Get("severity"),
+		Dimension:      query.Get("dimension"),
+		Dimensions:     append(dimensions(), analyzerNames(custom)...),
+		Labels:         analyzerLabels(custom),
+	}
+
+	if view.Sort == "" {
+		view.Sort = "severity"
+	}
+	if severityRank(view.Severity) == len(severities) {
+		view.Severity = ""
+	}
+	if !contains(view.Dimensions, view.Dimension) {
+		view.Dimension = ""
+	}
+
+	return view
+}
+
+func dimensions() []string {
+	names := make([]string, len(analyzers))
+
+	for i := 0; i < len(analyzers); i++ {
+		names[i] = analyzers[i].Name
+	}
+
+	return append(names, lintAnalyzer)
+}
+
+func severityRank(severity string) int {
+	for i := 0; i < len(severities); i++ {
+		if severities[i] == severity {
+			return i
+		}
+	}
+
+	return len(severities)
+}
+
+func normalizeSeverity(severity string) string {
+	severity = strings.ToLower(strings.TrimSpace(severity))
+
+	if severityRank(severity) == len(severities) {
+		return "minor"
+	}
+
+	return severity
+}
+
+// normalizeImpact rounds the impact to an integer between 0 and 10
+func normalizeImpact(impact float64) int16 {
+	return int16(math.Round(math.Max(0, math.Min(10, impact))))
+}
@@ -0,0 +1,182 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+	"github.com/felixbrock/prompt-grammarly/internal/tokenizer"
+)
+
+// OpenAI's documented overhead of the chat format, per message and for priming the reply
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// formNumber accepts numbers and the strings forms send, where an empty string means 0
+type formNumber float64
+
+func (n *formNumber) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	var number float64
+	switch value := raw.(type) {
+	case nil:
+	case float64:
+		number = value
+	case string:
+		if strings.TrimSpace(value) != "" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %s", value)
+			}
+			number = parsed
+		}
+	default:
+		return fmt.Errorf("invalid number %v", value)
+	}
+
+	if number < 0 {
+		return fmt.Errorf("invalid number %v", number)
+	}
+
+	*n = formNumber(number)
+	return nil
+}
+
+type TokenCount struct {
+	Tokens int
+	// Exact is false if the encoding isn't available and the count is estimated
+	Exact bool
+}
+
+func (c TokenCount) String() string {
+	if c.Exact {
+		return fmt.Sprintf("%d tokens", c.Tokens)
+	}
+
+	return fmt.Sprintf("~%d tokens", c.Tokens)
+}
+
+// TokenView compares the token counts of a prompt and its optimized version
+type TokenView struct {
+	Encoding  string
+	Original  TokenCount
+	Optimized TokenCount
+	// Budget is the maximum token count of the optimized prompt, 0 if there is none
+	Budget int
+}
+
+func (v TokenView) Delta() int {
+	return v.Optimized.Tokens - v.Original.Tokens
+}
+
+func (v TokenView) OverBudget() bool {
+	return v.Budget > 0 && v.Optimized.Tokens > v.Budget
+}
+
+// tokenCounter counts tokens with the encoding of the configured model. Without the encoding's
+// rank file it falls back to an estimate.
+type tokenCounter struct {
+	encodingName string
+	encoding     *tokenizer.Encoding
+}
+
+func newTokenCounter(config *Config) tokenCounter {
+	name, err := tokenizer.EncodingForModel(config.TokenizerModel)
+
+	if err != nil {
+		slog.Warn("Estimating token counts", "model", config.TokenizerModel, "error", err)
+		return tokenCounter{}
+	}
+
+	encoding, err := tokenizer.Load(config.TokenizerDir, name)
+
+	if err != nil {
+		slog.Warn("Estimating token counts as the encoding can't be loaded", "encoding", name, "error", err)
+		return tokenCounter{encodingName: name}
+	}
+
+	return tokenCounter{encodingName: name, encoding: encoding}
+}
+
+func (c tokenCounter) count(text string) TokenCount {
+	if c.encoding == nil {
+		return TokenCount{Tokens: tokenizer.Estimate(text), Exact: false}
+	}
+
+	return TokenCount{Tokens: c.encoding.Count(text), Exact: true}
+}
+
+// countPrompt counts chat prompts the way the chat completions API does, by their message
+// contents plus the overhead of the chat format
+func (c tokenCounter) countPrompt(prompt string) TokenCount {
+	messages, ok := parseChatPrompt(prompt)
+	if !ok {
+		return c.count(prompt)
+	}
+
+	total := TokenCount{Tokens: tokensPerReply, Exact: c.encoding != nil}
+	for i := 0; i < len(messages); i++ {
+		total.Tokens += tokensPerMessage + c.count(messages[i].Role).Tokens + c.count(messages[i].Content).Tokens
+	}
+
+	return total
+}
+
+func (c tokenCounter) view(op *domain.Optimization) TokenView {
+	return TokenView{
+		Encoding:  c.encodingName,
+		Original:  c.countPrompt(op.OriginalPrompt),
+		Optimized: c.countPrompt(op.OptimizedPrompt),
+		Budget:    op.MaxTokens}
+}
+
+// deltas returns by how many tokens applying each suggestion changes the prompt
+func (c tokenCounter) deltas(suggs []domain.Suggestion) map[string]int {
+	deltas := make(map[string]int, len(suggs))
+
+	for i := 0; i < len(suggs); i++ {
+		deltas[suggs[i].Id] = c.count(suggs[i].Suggestion).Tokens - c.count(suggs[i].Target).Tokens
+	}
+
+	return deltas
+}
+
+func budgetCtx(budget int, encoding string) string {
+	if budget <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(`The improved model instructions must not exceed %d tokens (%s encoding). Prefer concise
+		wording and drop the least important suggestions if all suggestions don't fit into the budget.`, budget, encoding)
+}
+
+// usageMeter sums the tokens consumed by model calls, which may run concurrently
+type usageMeter struct {
+	tokens atomic.Int64
+}
+
+func (m *usageMeter) add(usage *OAIUsage) {
+	if m == nil || usage == nil {
+		return
+	}
+
+	m.tokens.Add(int64(usage.TotalTokens))
+}
+
+func (m *usageMeter) total() int {
+	if m == nil {
+		return 0
+	}
+
+	return int(m.tokens.Load())
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TemplateVariable is a placeholder of the prompt that is filled in by the user's application
+type TemplateVariable struct {
+	Token  string
+	Name   string
+	Syntax string
+}
+
+func (v TemplateVariable) key() string {
+	return fmt.Sprintf("%s:%s", v.Syntax, v.Name)
+}
+
+type variableSyntax struct {
+	Name    string
+	Pattern string
+}
+
+// variableSyntaxes are tried in order, so syntaxes that contain others have to come first
+var variableSyntaxes = []variableSyntax{
+	{Name: "mustache", Pattern: `\{\{\s*([A-Za-z_][\w.]*)\s*(?:\|[^{}]*)?\}\}`},
+	{Name: "dollar_brace", Pattern: `\$\{([A-Za-z_]\w*)\}`},
+	{Name: "percent", Pattern: `%\(([A-Za-z_]\w*)\)[sdifr]`},
+	{Name: "brace", Pattern: `\{([A-Za-z_]\w*)\}`},
+	{Name: "dollar", Pattern: `\$([A-Z_][A-Z0-9_]*)\b`},
+}
+
+var variablePattern = compileVariablePattern()
+
+func compileVariablePattern() *regexp.Regexp {
+	patterns := make([]string, len(variableSyntaxes))
+	for i := 0; i < len(variableSyntaxes); i++ {
+		patterns[i] = variableSyntaxes[i].Pattern
+	}
+
+	return regexp.MustCompile(strings.Join(patterns, "|"))
+}
+
+// detectVariables returns the distinct template variables of a prompt in order of appearance.
+// Variables are told apart by syntax and name, so `{{ name }}` and `{{name}}` are the same variable.
+func detectVariables(prompt string) []TemplateVariable {
+	var variables []TemplateVariable
+	seen := make(map[string]bool)
+
+	matches := variablePattern.FindAllStringSubmatch(prompt, -1)
+	for i := 0; i < len(matches); i++ {
+		// every syntax has a single group, the one that matched holds the name
+		for j := 1; j < len(matches[i]); j++ {
+			if matches[i][j] == "" {
+				continue
+			}
+
+			variable := TemplateVariable{Token: matches[i][0], Name: matches[i][j], Syntax: variableSyntaxes[j-1].Name}
+			if !seen[variable.key()] {
+				seen[variable.key()] = true
+				variables = append(variables, variable)
+			}
+			break
+		}
+	}
+
+	return variables
+}
+
+// VariableCheck compares the template variables of the original and the optimized prompt
+type VariableCheck struct {
+	Missing []TemplateVariable
+	Added   []TemplateVariable
+}
+
+func (c VariableCheck) Preserved() bool {
+	return len(c.Missing) == 0 && len(c.Added) == 0
+}
+
+func checkVariables(original []TemplateVariable, optimized string) VariableCheck {
+	var check VariableCheck
+
+	optimizedVars := detectVariables(optimized)
+
+	keys := make(map[string]bool)
+	for i := 0; i < len(optimizedVars); i++ {
+		keys[optimizedVars[i].key()] = true
+	}
+	for i := 0; i < len(original); i++ {
+		if !keys[original[i].key()] {
+			check.Missing = append(check.Missing, original[i])
+		}
+	}
+
+	keys = make(map[string]bool)
+	for i := 0; i < len(original); i++ {
+		keys[original[i].key()] = true
+	}
+	for i := 0; i < len(optimizedVars); i++ {
+		if !keys[optimizedVars[i].key()] {
+			check.Added = append(check.Added, optimizedVars[i])
+		}
+	}
+
+	return check
+}
+
+func variableTokens(variables []TemplateVariable) string {
+	tokens := make([]string, len(variables))
+	for i := 0; i < len(variables); i++ {
+		tokens[i] = variables[i].Token
+	}
+
+	return strings.Join(tokens, ", ")
+}
+
+// variablesCtx tells assistants which tokens of the model instructions must not be changed
+func variablesCtx(variables []TemplateVariable) string {
+	if len(variables) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(`Protected Tokens:
+
+			The model instructions contain the following template variables, which are filled in by the user's application: %s
+			Treat them as protected tokens. Never rename, reformat or remove them and don't introduce new template variables.
+			`, variableTokens(variables))
+}
@@ -1,21 +1,59 @@
 package domain
 
 type Suggestion struct {
+	Id             string   `json:"id"`
+	Suggestion     string   `json:"suggestion"`
+	Reasoning      string   `json:"reasoning"`
+	Target         string   `json:"target"`
+	Type           string   `json:"type"`
+	Analyzers      []string `json:"analyzers"`
+	Severity       string   `json:"severity"`
+	Impact         int16    `json:"impact"`
+	UserFeedback   int16    `json:"user_feedback"`
+	RunId          string   `json:"run_id"`
+	OptimizationId string   `json:"optimization_id"`
+	// MessageIndex refers to the message of a chat prompt the suggestion targets
+	MessageIndex *int `json:"message_index,omitempty"`
+	// RuleId is the lint rule that found the issue, empty for suggestions of assistants
+	RuleId string `json:"rule_id,omitempty"`
+}
+
+// ChatMessage is a message of a chat prompt. Chat prompts are stored as JSON arrays of messages.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// FeedbackEvent is an append-only record of a user rating a suggestion. Value is 1 for an
+// upvote, -1 for an exclusion and 0 when a previous rating was undone.
+type FeedbackEvent struct {
 	Id             string `json:"id"`
-	Suggestion     string `json:"suggestion"`
-	Reasoning      string `json:"reasoning"`
-	Target         string `json:"target"`
-	Type           string `json:"type"`
-	UserFeedback   int16  `json:"user_feedback"`
-	RunId          string `json:"run_id"`
+	SuggestionId   string `json:"suggestion_id"`
 	OptimizationId string `json:"optimization_id"`
+	SessionId      string `json:"session_id"`
+	Value          int16  `json:"value"`
+	Reason         string `json:"reason"`
+	CreatedAt      string `json:"created_at,omitempty"`
+}
+
+// Profile keeps track of when a session last reset its learned preferences. Only feedback
+// given after ResetAt is considered.
+type Profile struct {
+	SessionId string `json:"session_id"`
+	ResetAt   string `json:"reset_at"`
 }
 
+// Run is an analyzer's analysis of an optimization. Score rates the original prompt in the
+// analyzer's dimension from 0 to 10 and OptimizedScore the optimized prompt.
 type Run struct {
-	Id             string `json:"id"`
-	Type           string `json:"type"`
-	State          string `json:"state"`
-	OptimizationId string `json:"optimization_id"`
+	Id                 string `json:"id"`
+	Type               string `json:"type"`
+	State              string `json:"state"`
+	OptimizationId     string `json:"optimization_id"`
+	Score              *int16 `json:"score,omitempty"`
+	Rationale          string `json:"rationale,omitempty"`
+	OptimizedScore     *int16 `json:"optimized_score,omitempty"`
+	OptimizedRationale string `json:"optimized_rationale,omitempty"`
 }
 
 type Optimization struct {
@@ -23,6 +61,117 @@ type Optimization struct {
 	OriginalPrompt  string `json:"original_prompt"`
 	OptimizedPrompt string `json:"optimized_prompt"`
 	Instructions    string `json:"instructions"`
+	// MaxTokens is the token budget of the optimized prompt, 0 if there is none
+	MaxTokens       int    `json:"max_tokens,omitempty"`
 	State           string `json:"state"`
 	ParentId        string `json:"parent_id"`
+	SessionId       string `json:"session_id"`
+	BatchId         string `json:"batch_id,omitempty"`
+	ExternalId      string `json:"external_id,omitempty"`
+	LibraryPromptId string `json:"library_prompt_id,omitempty"`
+	AutoRunId       string `json:"auto_run_id,omitempty"`
+	// Analyzers are the ids of the custom analyzers the optimization runs in addition to the built-in ones
+	Analyzers []string `json:"analyzers,omitempty"`
+	// TokensUsed sums the tokens consumed by the model calls of the optimization
+	TokensUsed int `json:"tokens_used,omitempty"`
+	// Redactions is the encrypted map of the placeholders that replaced secrets and personal data
+	Redactions string `json:"redactions,omitempty"`
+	CreatedAt  string `json:"created_at,omitempty"`
+}
+
+// LibraryPrompt is a named prompt of the library. Every optimization linked to it is a version
+// of the prompt.
+type LibraryPrompt struct {
+	Id          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Owner       string   `json:"owner"`
+	CreatedAt   string   `json:"created_at,omitempty"`
+}
+
+// Batch groups optimizations that were uploaded together. ExternalId of those optimizations
+// refers to the id the uploaded row was given by the user.
+type Batch struct {
+	Id        string `json:"id"`
+	SessionId string `json:"session_id"`
+	State     string `json:"state"`
+	Total     int    `json:"total"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// Share grants read-only access to an optimization. Only the hash of the share token is stored.
+type Share struct {
+	Id             string `json:"id"`
+	OptimizationId string `json:"optimization_id"`
+	TokenHash      string `json:"token_hash"`
+	ExpiresAt      string `json:"expires_at"`
+	Revoked        bool   `json:"revoked"`
+	CreatedAt      string `json:"created_at,omitempty"`
+}
+
+// Evaluation compares the outputs of the original and the optimized prompt of an optimization
+// for sample inputs. Outputs are scored by an LLM judge if Judge is set and checked against the
+// assertions, e.g. `contains: json`. Red team evaluations replace the sample inputs with canned
+// injection attempts.
+type Evaluation struct {
+	Id             string   `json:"id"`
+	OptimizationId string   `json:"optimization_id"`
+	SessionId      string   `json:"session_id"`
+	Model          string   `json:"model"`
+	Judge          bool     `json:"judge"`
+	Assertions     []string `json:"assertions"`
+	RedTeam        bool     `json:"red_team"`
+	State          string   `json:"state"`
+	// Redactions is the sealed placeholder map of the redacted sample inputs
+	Redactions string `json:"redactions,omitempty"`
+	CreatedAt  string `json:"created_at,omitempty"`
+}
+
+// EvaluationCase is the comparison of both prompts for one sample input. Scores range from 1 to 10
+// and are 0 without a judge. Winner is either "original", "optimized" or "tie".
+type EvaluationCase struct {
+	Id              string   `json:"id"`
+	EvaluationId    string   `json:"evaluation_id"`
+	OptimizationId  string   `json:"optimization_id"`
+	Position        int      `json:"position"`
+	Input           string   `json:"input"`
+	OriginalOutput  string   `json:"original_output"`
+	OptimizedOutput string   `json:"optimized_output"`
+	OriginalScore   float64  `json:"original_score"`
+	OptimizedScore  float64  `json:"optimized_score"`
+	OriginalPassed  int      `json:"original_passed"`
+	OptimizedPassed int      `json:"optimized_passed"`
+	Failures        []string `json:"failures"`
+	Winner          string   `json:"winner"`
+	Reasoning       string   `json:"reasoning"`
+}
+
+// AutoRun chains regenerations of an optimization until the analyzers' scores reach TargetScore,
+// stop improving, MaxIterations versions were generated or MaxSpend tokens were consumed.
+// OptimizationId refers to the optimization the run started from, BestId to the best scored version.
+type AutoRun struct {
+	Id             string  `json:"id"`
+	OptimizationId string  `json:"optimization_id"`
+	SessionId      string  `json:"session_id"`
+	TargetScore    float64 `json:"target_score"`
+	MaxIterations  int     `json:"max_iterations"`
+	MaxSpend       int     `json:"max_spend"`
+	State          string  `json:"state"`
+	StopReason     string  `json:"stop_reason"`
+	BestId         string  `json:"best_id"`
+	Iterations     int     `json:"iterations"`
+	Spent          int     `json:"spent"`
+	CreatedAt      string  `json:"created_at,omitempty"`
+}
+
+// CustomAnalyzer is a dimension defined by a user, which prompts are analyzed in next to the
+// built-in dimensions. Name is the type of its runs and suggestions, Label how it is displayed.
+type CustomAnalyzer struct {
+	Id           string `json:"id"`
+	Name         string `json:"name"`
+	Label        string `json:"label"`
+	Instructions string `json:"instructions"`
+	Owner        string `json:"owner"`
+	CreatedAt    string `json:"created_at,omitempty"`
 }
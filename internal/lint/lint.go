@@ -0,0 +1,122 @@
+// Package lint checks prompts against deterministic rules, which catch common issues without
+// a model round-trip.
+package lint
+
+import (
+	"fmt"
+	"strings"
+)
+
+const maxFindingsPerRule = 5
+
+// Finding is an issue a rule found. Target quotes the affected part of the prompt and Index is the
+// position of the checked text, or -1 for rules that check all texts at once.
+type Finding struct {
+	RuleId     string
+	Index      int
+	Target     string
+	Suggestion string
+	Reasoning  string
+	Severity   string
+	Impact     int16
+}
+
+// Rule checks a text. Document rules check all texts of a prompt joined, e.g. all messages of a
+// chat prompt, as their issue can be solved in any of them.
+type Rule struct {
+	Id          string
+	Description string
+	Document    bool
+	Check       func(text string) []Finding
+}
+
+// Rules are all available rules in the order they are run
+var Rules = []Rule{
+	vagueQuantifier,
+	contradictoryDirective,
+	duplicateSentence,
+	unbalancedCodeFence,
+	unbalancedQuotes,
+	missingOutputFormat,
+}
+
+type Linter struct {
+	rules []Rule
+}
+
+// New returns a linter running every rule but the disabled ones
+func New(disabled []string) (*Linter, error) {
+	known := make(map[string]bool)
+	for i := 0; i < len(Rules); i++ {
+		known[Rules[i].Id] = true
+	}
+
+	skip := make(map[string]bool)
+	for i := 0; i < len(disabled); i++ {
+		if !known[disabled[i]] {
+			return nil, fmt.Errorf("unknown lint rule %s", disabled[i])
+		}
+		skip[disabled[i]] = true
+	}
+
+	var linter Linter
+	for i := 0; i < len(Rules); i++ {
+		if !skip[Rules[i].Id] {
+			linter.rules = append(linter.rules, Rules[i])
+		}
+	}
+
+	return &linter, nil
+}
+
+// ParseRuleList reads a comma separated list of rule ids
+func ParseRuleList(list string) []string {
+	var ids []string
+
+	parts := strings.Split(list, ",")
+	for i := 0; i < len(parts); i++ {
+		if id := strings.TrimSpace(parts[i]); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+func limit(findings []Finding) []Finding {
+	if len(findings) > maxFindingsPerRule {
+		return findings[:maxFindingsPerRule]
+	}
+
+	return findings
+}
+
+// Run checks the texts of a prompt, which is a single text or the messages of a chat prompt
+func (l Linter) Run(texts ...string) []Finding {
+	var findings []Finding
+
+	for i := 0; i < len(l.rules); i++ {
+		rule := l.rules[i]
+
+		if rule.Document {
+			ruleFindings := limit(rule.Check(strings.Join(texts, "\n\n")))
+			for j := 0; j < len(ruleFindings); j++ {
+				ruleFindings[j].RuleId = rule.Id
+				ruleFindings[j].Index = -1
+			}
+			findings = append(findings, ruleFindings...)
+			continue
+		}
+
+		for j := 0; j < len(texts); j++ {
+			ruleFindings := limit(rule.Check(texts[j]))
+			for k := 0; k < len(ruleFindings); k++ {
+				ruleFindings[k].RuleId = rule.Id
+				ruleFindings[k].Index = j
+			}
+			findings = append(findings, ruleFindings...)
+		}
+	}
+
+	return findings
+}
@@ -0,0 +1,197 @@
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var vagueQuantifierPattern = regexp.MustCompile(`(?i)\b(some|a few|several|many|various|numerous|a lot of|lots of|a bit|a couple of|a number of)\b`)
+
+var vagueQuantifier = Rule{
+	Id:          "vague-quantifier",
+	Description: `Quantities like "some" or "a few" leave the model guessing how much is expected`,
+	Check: func(text string) []Finding {
+		var findings []Finding
+
+		all := sentences(text)
+		for i := 0; i < len(all); i++ {
+			match := vagueQuantifierPattern.FindString(all[i])
+			if match == "" {
+				continue
+			}
+
+			findings = append(findings, Finding{
+				Target:     all[i],
+				Suggestion: fmt.Sprintf(`Replace "%s" with an exact number or range, e.g. "3" or "2 to 4"`, match),
+				Reasoning:  fmt.Sprintf(`"%s" is a vague quantifier. The model has to guess the intended amount, which makes outputs inconsistent.`, match),
+				Severity:   "minor",
+				Impact:     3})
+		}
+
+		return findings
+	},
+}
+
+var (
+	alwaysPattern = regexp.MustCompile(`(?i)\b(always|must)\b`)
+	neverPattern  = regexp.MustCompile(`(?i)\b(never|must not|mustn't|do not ever|under no circumstances)\b`)
+)
+
+const contradictionOverlap = 0.6
+
+var contradictoryDirective = Rule{
+	Id:          "contradictory-directive",
+	Description: "ALWAYS and NEVER directives that refer to the same behavior contradict each other",
+	Document:    true,
+	Check: func(text string) []Finding {
+		var always, never []string
+
+		all := sentences(text)
+		for i := 0; i < len(all); i++ {
+			if neverPattern.MatchString(all[i]) {
+				never = append(never, all[i])
+			} else if alwaysPattern.MatchString(all[i]) {
+				always = append(always, all[i])
+			}
+		}
+
+		var findings []Finding
+		for i := 0; i < len(never); i++ {
+			for j := 0; j < len(always); j++ {
+				if overlap(contentWords(never[i]), contentWords(always[j])) < contradictionOverlap {
+					continue
+				}
+
+				findings = append(findings, Finding{
+					Target:     never[i],
+					Suggestion: fmt.Sprintf(`Resolve the conflict with "%s" by stating which directive takes precedence and when`, always[j]),
+					Reasoning:  fmt.Sprintf(`"%s" and "%s" give opposite directives for the same behavior. The model can't follow both.`, never[i], always[j]),
+					Severity:   "major",
+					Impact:     7})
+				break
+			}
+		}
+
+		return findings
+	},
+}
+
+const minDuplicateWords = 4
+
+var duplicateSentence = Rule{
+	Id:          "duplicate-sentence",
+	Description: "Repeated sentences add length without adding information",
+	Document:    true,
+	Check: func(text string) []Finding {
+		var findings []Finding
+		seen := make(map[string]bool)
+		reported := make(map[string]bool)
+
+		all := sentences(text)
+		for i := 0; i < len(all); i++ {
+			sentenceWords := words(all[i])
+			if len(sentenceWords) < minDuplicateWords {
+				continue
+			}
+
+			key := strings.Join(sentenceWords, " ")
+			if seen[key] && !reported[key] {
+				reported[key] = true
+				findings = append(findings, Finding{
+					Target:     all[i],
+					Suggestion: "Remove the repeated sentence",
+					Reasoning:  "The sentence appears more than once. Repetitions make the instructions longer without adding information.",
+					Severity:   "minor",
+					Impact:     4})
+			}
+			seen[key] = true
+		}
+
+		return findings
+	},
+}
+
+var unbalancedCodeFence = Rule{
+	Id:          "unbalanced-code-fence",
+	Description: "Code fences that are not closed make the rest of the prompt part of the code block",
+	Check: func(text string) []Finding {
+		var fences []string
+
+		lines := strings.Split(text, "\n")
+		for i := 0; i < len(lines); i++ {
+			if strings.HasPrefix(strings.TrimSpace(lines[i]), "```") {
+				fences = append(fences, strings.TrimSpace(lines[i]))
+			}
+		}
+
+		if len(fences)%2 == 0 {
+			return nil
+		}
+
+		return []Finding{{
+			Target:     fences[len(fences)-1],
+			Suggestion: "Close the code block with a matching ``` line",
+			Reasoning:  "The prompt has an odd number of code fences, so one code block is never closed and the model may read the following instructions as code.",
+			Severity:   "major",
+			Impact:     6}}
+	},
+}
+
+var unbalancedQuotes = Rule{
+	Id:          "unbalanced-quotes",
+	Description: "Unbalanced quotes blur where quoted text ends",
+	Check: func(text string) []Finding {
+		var findings []Finding
+
+		unbalanced := func(target string, quote string) Finding {
+			return Finding{
+				Target:     target,
+				Suggestion: fmt.Sprintf("Close the quote that starts with %s", quote),
+				Reasoning:  "The prompt contains an unclosed quote, which blurs where quoted text such as examples or inputs ends.",
+				Severity:   "minor",
+				Impact:     4}
+		}
+
+		if strings.Count(text, `"""`)%2 == 1 {
+			findings = append(findings, unbalanced(lineOf(text, strings.LastIndex(text, `"""`)), `"""`))
+		}
+
+		single := strings.ReplaceAll(text, `"""`, "")
+		if strings.Count(single, `"`)%2 == 1 {
+			findings = append(findings, unbalanced(lineOf(single, strings.LastIndex(single, `"`)), `"`))
+		}
+
+		if strings.Count(text, "“") != strings.Count(text, "”") {
+			offset := strings.LastIndex(text, "“")
+			if offset == -1 {
+				offset = strings.LastIndex(text, "”")
+			}
+			findings = append(findings, unbalanced(lineOf(text, offset), "“"))
+		}
+
+		return findings
+	},
+}
+
+var outputFormatPattern = regexp.MustCompile(`(?i)\b(format(ted)?|json|markdown|yaml|xml|csv|table|bullet|list|respond (with|in)|reply (with|in)|answer (with|in)|return|output|structure)\b`)
+
+const minFormatWords = 10
+
+var missingOutputFormat = Rule{
+	Id:          "missing-output-format",
+	Description: "Prompts without output format instructions produce differently shaped outputs",
+	Document:    true,
+	Check: func(text string) []Finding {
+		if len(words(text)) < minFormatWords || outputFormatPattern.MatchString(text) {
+			return nil
+		}
+
+		return []Finding{{
+			Target:     "",
+			Suggestion: `Add an instruction that specifies the output format, e.g. "Respond in markdown with a short summary followed by a bullet list"`,
+			Reasoning:  "The prompt doesn't describe the expected output format, so the shape of the outputs varies between runs.",
+			Severity:   "major",
+			Impact:     5}}
+	},
+}
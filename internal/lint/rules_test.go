@@ -0,0 +1,152 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     Rule
+		text     string
+		findings int
+		target   string
+	}{
+		{"vague quantifier", vagueQuantifier, "List some examples of good names.", 1, "List some examples of good names."},
+		{"vague quantifier in every sentence", vagueQuantifier, "Give a few tips. Add several links.", 2, "Give a few tips."},
+		{"exact quantity", vagueQuantifier, "List 3 examples of good names.", 0, ""},
+		{"quantifier inside a word", vagueQuantifier, "Summarize the handsome text.", 0, ""},
+
+		{"contradictory directives", contradictoryDirective,
+			"Always include citations for claims. Never include citations for claims.", 1, "Never include citations for claims."},
+		{"unrelated directives", contradictoryDirective,
+			"Always answer in English. Never mention competitor products.", 0, ""},
+		{"only always directives", contradictoryDirective,
+			"Always include citations. Always answer in English.", 0, ""},
+
+		{"duplicate sentence", duplicateSentence,
+			"Answer the question briefly. Be polite. Answer the question briefly.", 1, "Answer the question briefly."},
+		{"duplicate sentence ignoring case and punctuation", duplicateSentence,
+			"Answer the question briefly!\nanswer the question, briefly.", 1, "answer the question, briefly."},
+		{"duplicate sentence reported once", duplicateSentence,
+			"Keep the answer very short. Keep the answer very short. Keep the answer very short.", 1, "Keep the answer very short."},
+		{"short repeated sentence", duplicateSentence, "Be polite. Be polite.", 0, ""},
+		{"distinct sentences", duplicateSentence, "Answer the question briefly. Answer the question in detail.", 0, ""},
+
+		{"unclosed code fence", unbalancedCodeFence, "Use this format:\n```json\n{}\n```\nOr:\n```yaml", 1, "```yaml"},
+		{"closed code fences", unbalancedCodeFence, "Use this format:\n```json\n{}\n```", 0, ""},
+		{"fence marker within a line", unbalancedCodeFence, "Wrap code in ``` fences.", 0, ""},
+
+		{"unclosed double quote", unbalancedQuotes, "Reply with \"yes or no.\nThen stop.", 1, "Reply with \"yes or no."},
+		{"unclosed triple quote", unbalancedQuotes, "Summarize the text:\n\"\"\"\nSome text", 1, "\"\"\""},
+		{"unclosed curly quote", unbalancedQuotes, "Reply with “yes or no.", 1, "Reply with “yes or no."},
+		{"balanced quotes", unbalancedQuotes, "Reply with \"yes\" or \"no\".\n\"\"\"\ntext\n\"\"\"", 0, ""},
+
+		{"missing output format", missingOutputFormat,
+			"You are a helpful assistant that answers questions about the history of Rome.", 1, ""},
+		{"output format given", missingOutputFormat,
+			"You are a helpful assistant that answers questions about Rome. Respond in markdown.", 0, ""},
+		{"short prompt", missingOutputFormat, "Translate to French.", 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := tt.rule.Check(tt.text)
+
+			if len(findings) != tt.findings {
+				t.Fatalf("got %d findings, want %d: %+v", len(findings), tt.findings, findings)
+			}
+			if tt.findings > 0 && tt.target != "" && findings[0].Target != tt.target {
+				t.Errorf("got target %q, want %q", findings[0].Target, tt.target)
+			}
+			for i := 0; i < len(findings); i++ {
+				if findings[i].Suggestion == "" || findings[i].Reasoning == "" || findings[i].Severity == "" || findings[i].Impact <= 0 {
+					t.Errorf("incomplete finding %+v", findings[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled string
+		rules    int
+		wantErr  bool
+	}{
+		{"all rules", "", len(Rules), false},
+		{"one disabled", "vague-quantifier", len(Rules) - 1, false},
+		{"several disabled with spaces", " vague-quantifier , missing-output-format,", len(Rules) - 2, false},
+		{"unknown rule", "vague-quantifier,no-such-rule", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			linter, err := New(ParseRuleList(tt.disabled))
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(linter.rules) != tt.rules {
+				t.Errorf("got %d rules, want %d", len(linter.rules), tt.rules)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	prompt := "You are an assistant that gives some tips about cooking pasta at home for beginners."
+
+	linter, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := make(map[string]int)
+	findings := linter.Run(prompt)
+	for i := 0; i < len(findings); i++ {
+		rules[findings[i].RuleId] = findings[i].Index
+	}
+	if index, ok := rules[vagueQuantifier.Id]; !ok || index != 0 {
+		t.Errorf("expected a %s finding for text 0, got %+v", vagueQuantifier.Id, findings)
+	}
+	if index, ok := rules[missingOutputFormat.Id]; !ok || index != -1 {
+		t.Errorf("expected a document finding of %s, got %+v", missingOutputFormat.Id, findings)
+	}
+
+	linter, err = New([]string{vagueQuantifier.Id, missingOutputFormat.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findings := linter.Run(prompt); len(findings) != 0 {
+		t.Errorf("disabled rules reported findings: %+v", findings)
+	}
+}
+
+func TestRunLimitsFindings(t *testing.T) {
+	linter, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prompt := strings.Repeat("Add some detail. ", maxFindingsPerRule+3) + "Respond in markdown."
+
+	count := 0
+	findings := linter.Run(prompt)
+	for i := 0; i < len(findings); i++ {
+		if findings[i].RuleId == vagueQuantifier.Id {
+			count++
+		}
+	}
+	if count != maxFindingsPerRule {
+		t.Errorf("got %d findings of %s, want %d", count, vagueQuantifier.Id, maxFindingsPerRule)
+	}
+}
@@ -0,0 +1,85 @@
+package lint
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var sentenceEnd = regexp.MustCompile(`[.!?]+(\s|$)|\n`)
+
+// sentences splits text at sentence punctuation and line breaks
+func sentences(text string) []string {
+	var result []string
+
+	start := 0
+	for _, loc := range sentenceEnd.FindAllStringIndex(text, -1) {
+		if sentence := strings.TrimSpace(text[start:loc[1]]); sentence != "" {
+			result = append(result, sentence)
+		}
+		start = loc[1]
+	}
+
+	if sentence := strings.TrimSpace(text[start:]); sentence != "" {
+		result = append(result, sentence)
+	}
+
+	return result
+}
+
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+}
+
+var stopwords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "to": true, "of": true, "in": true, "on": true,
+	"for": true, "with": true, "be": true, "is": true, "are": true, "you": true, "your": true, "it": true,
+	"that": true, "this": true, "always": true, "never": true, "do": true, "not": true, "don't": true, "must": true,
+}
+
+func contentWords(text string) map[string]bool {
+	result := make(map[string]bool)
+
+	all := words(text)
+	for i := 0; i < len(all); i++ {
+		if !stopwords[all[i]] {
+			result[all[i]] = true
+		}
+	}
+
+	return result
+}
+
+// overlap is the share of the smaller word set that is contained in the other one
+func overlap(a map[string]bool, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+
+	smaller := len(a)
+	if len(b) < smaller {
+		smaller = len(b)
+	}
+
+	return float64(shared) / float64(smaller)
+}
+
+// lineOf returns the line of text that contains the byte offset
+func lineOf(text string, offset int) string {
+	start := strings.LastIndex(text[:offset], "\n") + 1
+	end := strings.Index(text[offset:], "\n")
+	if end == -1 {
+		return strings.TrimSpace(text[start:])
+	}
+
+	return strings.TrimSpace(text[start : offset+end])
+}
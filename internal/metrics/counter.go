@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Counter is a value that only goes up, partitioned by labels
+type Counter struct {
+	metric string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	series
+	value float64
+}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{metric: name, help: help, labels: labels, series: make(map[string]*counterSeries)}
+	defaultRegistry.register(c)
+
+	return c
+}
+
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(v float64, values ...string) {
+	checkValues(c.metric, c.labels, values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.series[key(values)]
+	if !ok {
+		s = &counterSeries{series: series{labels: c.labels, values: append([]string{}, values...)}}
+		c.series[key(values)] = s
+	}
+
+	s.value += v
+}
+
+func (c *Counter) name() string {
+	return c.metric
+}
+
+func (c *Counter) write(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s counter\n", c.metric, c.help, c.metric))
+
+	keys := make([]string, 0, len(c.series))
+	for k := range c.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for i := 0; i < len(keys); i++ {
+		s := c.series[keys[i]]
+		b.WriteString(fmt.Sprintf("%s%s %s\n", c.metric, s.format(), formatFloat(s.value)))
+	}
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Histogram counts observations, e.g. durations in seconds, in cumulative buckets
+type Histogram struct {
+	metric  string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	series
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+
+	h := &Histogram{metric: name, help: help, labels: labels, buckets: sorted, series: make(map[string]*histogramSeries)}
+	defaultRegistry.register(h)
+
+	return h
+}
+
+func (h *Histogram) Observe(v float64, values ...string) {
+	checkValues(h.metric, h.labels, values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key(values)]
+	if !ok {
+		s = &histogramSeries{series: series{labels: h.labels, values: append([]string{}, values...)}, counts: make([]uint64, len(h.buckets))}
+		h.series[key(values)] = s
+	}
+
+	for i := 0; i < len(h.buckets); i++ {
+		if v <= h.buckets[i] {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) name() string {
+	return h.metric
+}
+
+func (h *Histogram) write(b *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s histogram\n", h.metric, h.help, h.metric))
+
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for i := 0; i < len(keys); i++ {
+		s := h.series[keys[i]]
+
+		for j := 0; j < len(h.buckets); j++ {
+			b.WriteString(fmt.Sprintf("%s_bucket%s %d\n", h.metric, s.format("le", formatFloat(h.buckets[j])), s.counts[j]))
+		}
+		b.WriteString(fmt.Sprintf("%s_bucket%s %d\n", h.metric, s.format("le", "+Inf"), s.count))
+		b.WriteString(fmt.Sprintf("%s_sum%s %s\n", h.metric, s.format(), formatFloat(s.sum)))
+		b.WriteString(fmt.Sprintf("%s_count%s %d\n", h.metric, s.format(), s.count))
+	}
+}
@@ -0,0 +1,106 @@
+// Package metrics keeps counters and histograms in memory and exposes them in the Prometheus text
+// format.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets suit HTTP handlers and database calls, in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// SlowBuckets suit model calls and analyzer runs, in seconds
+var SlowBuckets = []float64{0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300}
+
+type collector interface {
+	name() string
+	write(b *strings.Builder)
+}
+
+type registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+var defaultRegistry = &registry{}
+
+func (r *registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := 0; i < len(r.collectors); i++ {
+		if r.collectors[i].name() == c.name() {
+			panic(fmt.Sprintf("metric %s is already registered", c.name()))
+		}
+	}
+
+	r.collectors = append(r.collectors, c)
+}
+
+// Handler serves all registered metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defaultRegistry.mu.Lock()
+		collectors := append([]collector{}, defaultRegistry.collectors...)
+		defaultRegistry.mu.Unlock()
+
+		sort.Slice(collectors, func(i, j int) bool {
+			return collectors[i].name() < collectors[j].name()
+		})
+
+		var b strings.Builder
+		for i := 0; i < len(collectors); i++ {
+			collectors[i].write(&b)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write([]byte(b.String()))
+	})
+}
+
+// series identifies the values of one label combination
+type series struct {
+	labels []string
+	values []string
+}
+
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func (s series) format(extra ...string) string {
+	pairs := make([]string, 0, len(s.labels)+len(extra)/2)
+	for i := 0; i < len(s.labels); i++ {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, s.labels[i], escape(s.values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escape(extra[i+1])))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ","))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func checkValues(metric string, labels []string, values []string) {
+	if len(values) != len(labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", metric, len(labels), len(values)))
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,99 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/felixbrock/prompt-grammarly/internal/app"
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+type AutoRunRepo struct {
+	BaseHeaders []string
+	BaseUrl     string
+}
+
+func (r AutoRunRepo) Insert(ctx context.Context, run domain.AutoRun) error {
+	body, err := json.Marshal(run)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = request[domain.AutoRun](ctx, reqConfig{
+		Method:  "POST",
+		Url:     r.BaseUrl,
+		Body:    body,
+		Headers: append(r.BaseHeaders, "Content-Type:application/json")},
+		201)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r AutoRunRepo) Update(ctx context.Context, id string, opts app.AutoRunUpdateOpts) error {
+	body, err := json.Marshal(opts)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = request[domain.AutoRun](ctx, reqConfig{
+		Method:    "PATCH",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
+		Body:      body,
+		Headers:   append(r.BaseHeaders, "Content-Type:application/json")},
+		204)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r AutoRunRepo) Read(ctx context.Context, id string) (*domain.AutoRun, error) {
+	records, err := request[[]domain.AutoRun](ctx, reqConfig{
+		Method:    "GET",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
+		Body:      nil,
+		Headers:   r.BaseHeaders},
+		200)
+
+	if err != nil {
+		return nil, err
+	} else if len(*records) == 0 {
+		return nil, errors.New("no auto run found")
+	} else if len(*records) > 1 {
+		return nil, errors.New("multiple auto runs found")
+	}
+
+	return &(*records)[0], nil
+}
+
+func (r AutoRunRepo) ReadMany(ctx context.Context, opIdCond string) (*[]domain.AutoRun, error) {
+	records, err := request[[]domain.AutoRun](ctx, reqConfig{
+		Method:    "GET",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("optimization_id=%s", opIdCond), "order=created_at.desc"},
+		Body:      nil,
+		Headers:   r.BaseHeaders},
+		200)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (r AutoRunRepo) Delete(ctx context.Context, opIdCond string) (int, error) {
+	return deleteRecords(ctx, r.BaseUrl, r.BaseHeaders, []string{fmt.Sprintf("optimization_id=%s", opIdCond)})
+}
@@ -0,0 +1,74 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+type BatchRepo struct {
+	BaseHeaders []string
+	BaseUrl     string
+}
+
+func (r BatchRepo) Insert(ctx context.Context, batch domain.Batch) error {
+	body, err := json.Marshal(batch)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = request[domain.Batch](ctx, reqConfig{
+		Method:  "POST",
+		Url:     r.BaseUrl,
+		Body:    body,
+		Headers: append(r.BaseHeaders, "Content-Type:application/json")},
+		201)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r BatchRepo) Update(ctx context.Context, id string, state string) error {
+	body := []byte(fmt.Sprintf(`{"state": "%s"}`, state))
+
+	_, err := request[domain.Batch](ctx, reqConfig{
+		Method:    "PATCH",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
+		Body:      body,
+		Headers:   append(r.BaseHeaders, "Content-Type:application/json")},
+		204)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r BatchRepo) Read(ctx context.Context, id string) (*domain.Batch, error) {
+	records, err := request[[]domain.Batch](ctx, reqConfig{
+		Method:    "GET",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
+		Body:      nil,
+		Headers:   r.BaseHeaders},
+		200)
+
+	if err != nil {
+		return nil, err
+	} else if len(*records) == 0 {
+		return nil, errors.New("no batch found")
+	} else if len(*records) > 1 {
+		return nil, errors.New("multiple batches found")
+	}
+
+	return &(*records)[0], nil
+}
@@ -0,0 +1,71 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/felixbrock/prompt-grammarly/internal/app"
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+type CustomAnalyzerRepo struct {
+	BaseHeaders []string
+	BaseUrl     string
+}
+
+func (r CustomAnalyzerRepo) Insert(ctx context.Context, analyzer domain.CustomAnalyzer) error {
+	body, err := json.Marshal(analyzer)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = request[domain.CustomAnalyzer](ctx, reqConfig{
+		Method:  "POST",
+		Url:     r.BaseUrl,
+		Body:    body,
+		Headers: append(r.BaseHeaders, "Content-Type:application/json")},
+		201)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r CustomAnalyzerRepo) Delete(ctx context.Context, id string) error {
+	_, err := deleteRecords(ctx, r.BaseUrl, r.BaseHeaders, []string{fmt.Sprintf("id=eq.%s", id)})
+
+	return err
+}
+
+func (r CustomAnalyzerRepo) getFilterParams(filter app.AnalyzerReadFilter) []string {
+	params := []string{"order=label.asc"}
+
+	if filter.IdCond != "" {
+		params = append(params, fmt.Sprintf("id=%s", filter.IdCond))
+	}
+	if filter.OwnerCond != "" {
+		params = append(params, fmt.Sprintf("owner=%s", filter.OwnerCond))
+	}
+
+	return params
+}
+
+func (r CustomAnalyzerRepo) ReadMany(ctx context.Context, filter app.AnalyzerReadFilter) (*[]domain.CustomAnalyzer, error) {
+	records, err := request[[]domain.CustomAnalyzer](ctx, reqConfig{
+		Method:    "GET",
+		Url:       r.BaseUrl,
+		UrlParams: r.getFilterParams(filter),
+		Body:      nil,
+		Headers:   r.BaseHeaders},
+		200)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
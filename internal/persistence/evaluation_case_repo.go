@@ -0,0 +1,55 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+type EvaluationCaseRepo struct {
+	BaseHeaders []string
+	BaseUrl     string
+}
+
+func (r EvaluationCaseRepo) Insert(ctx context.Context, cases []domain.EvaluationCase) error {
+	body, err := json.Marshal(cases)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = request[[]domain.EvaluationCase](ctx, reqConfig{
+		Method:  "POST",
+		Url:     r.BaseUrl,
+		Body:    body,
+		Headers: append(r.BaseHeaders, "Content-Type:application/json")},
+		201)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r EvaluationCaseRepo) Read(ctx context.Context, evaluationId string) (*[]domain.EvaluationCase, error) {
+	records, err := request[[]domain.EvaluationCase](ctx, reqConfig{
+		Method:    "GET",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("evaluation_id=eq.%s", evaluationId), "order=position.asc"},
+		Body:      nil,
+		Headers:   r.BaseHeaders},
+		200)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (r EvaluationCaseRepo) Delete(ctx context.Context, opIdCond string) (int, error) {
+	return deleteRecords(ctx, r.BaseUrl, r.BaseHeaders, []string{fmt.Sprintf("optimization_id=%s", opIdCond)})
+}
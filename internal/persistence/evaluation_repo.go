@@ -0,0 +1,94 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+type EvaluationRepo struct {
+	BaseHeaders []string
+	BaseUrl     string
+}
+
+func (r EvaluationRepo) Insert(ctx context.Context, evaluation domain.Evaluation) error {
+	body, err := json.Marshal(evaluation)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = request[domain.Evaluation](ctx, reqConfig{
+		Method:  "POST",
+		Url:     r.BaseUrl,
+		Body:    body,
+		Headers: append(r.BaseHeaders, "Content-Type:application/json")},
+		201)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r EvaluationRepo) Update(ctx context.Context, id string, state string) error {
+	body := []byte(fmt.Sprintf(`{"state": "%s"}`, state))
+
+	_, err := request[domain.Evaluation](ctx, reqConfig{
+		Method:    "PATCH",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
+		Body:      body,
+		Headers:   append(r.BaseHeaders, "Content-Type:application/json")},
+		204)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r EvaluationRepo) Read(ctx context.Context, id string) (*domain.Evaluation, error) {
+	records, err := request[[]domain.Evaluation](ctx, reqConfig{
+		Method:    "GET",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
+		Body:      nil,
+		Headers:   r.BaseHeaders},
+		200)
+
+	if err != nil {
+		return nil, err
+	} else if len(*records) == 0 {
+		return nil, errors.New("no evaluation found")
+	} else if len(*records) > 1 {
+		return nil, errors.New("multiple evaluations found")
+	}
+
+	return &(*records)[0], nil
+}
+
+func (r EvaluationRepo) ReadMany(ctx context.Context, opIdCond string) (*[]domain.Evaluation, error) {
+	records, err := request[[]domain.Evaluation](ctx, reqConfig{
+		Method:    "GET",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("optimization_id=%s", opIdCond), "order=created_at.desc"},
+		Body:      nil,
+		Headers:   r.BaseHeaders},
+		200)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (r EvaluationRepo) Delete(ctx context.Context, opIdCond string) (int, error) {
+	return deleteRecords(ctx, r.BaseUrl, r.BaseHeaders, []string{fmt.Sprintf("optimization_id=%s", opIdCond)})
+}
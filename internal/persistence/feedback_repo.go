@@ -0,0 +1,78 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/felixbrock/prompt-grammarly/internal/app"
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+type FeedbackRepo struct {
+	BaseHeaders []string
+	BaseUrl     string
+}
+
+func (r FeedbackRepo) Insert(ctx context.Context, event domain.FeedbackEvent) error {
+	body, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = request[domain.FeedbackEvent](ctx, reqConfig{
+		Method:  "POST",
+		Url:     r.BaseUrl,
+		Body:    body,
+		Headers: append(r.BaseHeaders, "Content-Type:application/json")},
+		201)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r FeedbackRepo) getFilterParams(filter app.FeedbReadFilter) []string {
+	params := []string{"order=created_at.desc"}
+
+	if filter.SuggIdCond != "" {
+		params = append(params, fmt.Sprintf("suggestion_id=%s", filter.SuggIdCond))
+	}
+	if filter.OpIdCond != "" {
+		params = append(params, fmt.Sprintf("optimization_id=%s", filter.OpIdCond))
+	}
+	if filter.SessionIdCond != "" {
+		params = append(params, fmt.Sprintf("session_id=%s", filter.SessionIdCond))
+	}
+	if filter.CreatedAtCond != "" {
+		params = append(params, fmt.Sprintf("created_at=%s", filter.CreatedAtCond))
+	}
+	if filter.Limit > 0 {
+		params = append(params, fmt.Sprintf("limit=%d", filter.Limit))
+	}
+
+	return params
+}
+
+func (r FeedbackRepo) Read(ctx context.Context, filter app.FeedbReadFilter) (*[]domain.FeedbackEvent, error) {
+	records, err := request[[]domain.FeedbackEvent](ctx, reqConfig{
+		Method:    "GET",
+		Url:       r.BaseUrl,
+		UrlParams: r.getFilterParams(filter),
+		Body:      nil,
+		Headers:   r.BaseHeaders},
+		200)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (r FeedbackRepo) Delete(ctx context.Context, opIdCond string) (int, error) {
+	return deleteRecords(ctx, r.BaseUrl, r.BaseHeaders, []string{fmt.Sprintf("optimization_id=%s", opIdCond)})
+}
@@ -0,0 +1,121 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/felixbrock/prompt-grammarly/internal/app"
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+type LibraryRepo struct {
+	BaseHeaders []string
+	BaseUrl     string
+}
+
+func (r LibraryRepo) Insert(ctx context.Context, prompt domain.LibraryPrompt) error {
+	body, err := json.Marshal(prompt)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = request[domain.LibraryPrompt](ctx, reqConfig{
+		Method:  "POST",
+		Url:     r.BaseUrl,
+		Body:    body,
+		Headers: append(r.BaseHeaders, "Content-Type:application/json")},
+		201)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r LibraryRepo) Update(ctx context.Context, id string, opts app.LibUpdateOpts) error {
+	body, err := json.Marshal(opts)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = request[domain.LibraryPrompt](ctx, reqConfig{
+		Method:    "PATCH",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
+		Body:      body,
+		Headers:   append(r.BaseHeaders, "Content-Type:application/json")},
+		204)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r LibraryRepo) Delete(ctx context.Context, id string) error {
+	_, err := request[domain.LibraryPrompt](ctx, reqConfig{
+		Method:    "DELETE",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
+		Body:      nil,
+		Headers:   r.BaseHeaders},
+		204)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r LibraryRepo) Read(ctx context.Context, id string) (*domain.LibraryPrompt, error) {
+	records, err := r.ReadMany(ctx, app.LibReadFilter{IdCond: fmt.Sprintf("eq.%s", id)})
+
+	if err != nil {
+		return nil, err
+	} else if len(*records) == 0 {
+		return nil, errors.New("no library prompt found")
+	} else if len(*records) > 1 {
+		return nil, errors.New("multiple library prompts found")
+	}
+
+	return &(*records)[0], nil
+}
+
+func (r LibraryRepo) getFilterParams(filter app.LibReadFilter) []string {
+	params := []string{"order=name.asc"}
+
+	if filter.IdCond != "" {
+		params = append(params, fmt.Sprintf("id=%s", filter.IdCond))
+	}
+	if filter.OwnerCond != "" {
+		params = append(params, fmt.Sprintf("owner=%s", filter.OwnerCond))
+	}
+	if filter.TagsCond != "" {
+		params = append(params, fmt.Sprintf("tags=%s", filter.TagsCond))
+	}
+
+	return params
+}
+
+func (r LibraryRepo) ReadMany(ctx context.Context, filter app.LibReadFilter) (*[]domain.LibraryPrompt, error) {
+	records, err := request[[]domain.LibraryPrompt](ctx, reqConfig{
+		Method:    "GET",
+		Url:       r.BaseUrl,
+		UrlParams: r.getFilterParams(filter),
+		Body:      nil,
+		Headers:   r.BaseHeaders},
+		200)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
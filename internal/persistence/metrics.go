@@ -0,0 +1,47 @@
+package persistence
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/felixbrock/prompt-grammarly/internal/metrics"
+)
+
+// externalBuckets span fast database reads as well as slow completions, in seconds
+var externalBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+var (
+	externalCalls = metrics.NewCounter("external_requests_total",
+		"Requests to the database, OpenAI and PostHog by service, endpoint, method and status code.", "service", "endpoint", "method", "code")
+	externalDuration = metrics.NewHistogram("external_request_duration_seconds",
+		"Duration of requests to the database, OpenAI and PostHog by service, endpoint and method.", externalBuckets,
+		"service", "endpoint", "method")
+)
+
+var apiVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// endpoint identifies the called service and the path with ids replaced, e.g. /v1/threads/:id/runs
+func endpoint(rawUrl string) (string, string) {
+	u, err := url.Parse(rawUrl)
+
+	if err != nil {
+		return "unknown", "unknown"
+	}
+
+	service := "db"
+	if strings.HasSuffix(u.Hostname(), "openai.com") {
+		service = "openai"
+	} else if strings.Contains(u.Hostname(), "posthog") {
+		service = "posthog"
+	}
+
+	segments := strings.Split(u.Path, "/")
+	for i := 0; i < len(segments); i++ {
+		if strings.ContainsAny(segments[i], "0123456789") && !apiVersion.MatchString(segments[i]) {
+			segments[i] = ":id"
+		}
+	}
+
+	return service, strings.Join(segments, "/")
+}
@@ -2,6 +2,7 @@ package persistence
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/felixbrock/prompt-grammarly/internal/app"
@@ -11,11 +12,11 @@ type OAIRepo struct {
 	BaseHeaders []string
 }
 
-func (r OAIRepo) GetRun(threadId string, runId string) (*app.OAIRun, error) {
+func (r OAIRepo) GetRun(ctx context.Context, threadId string, runId string) (*app.OAIRun, error) {
 
 	url := fmt.Sprintf("https://api.openai.com/v1/threads/%s/runs/%s", threadId, runId)
 
-	record, err := request[app.OAIRun](context.TODO(), reqConfig{Method: "GET", Url: url, Headers: r.BaseHeaders}, 200)
+	record, err := request[app.OAIRun](ctx, reqConfig{Method: "GET", Url: url, Headers: r.BaseHeaders}, 200)
 
 	if err != nil {
 		return nil, err
@@ -24,11 +25,11 @@ func (r OAIRepo) GetRun(threadId string, runId string) (*app.OAIRun, error) {
 	return record, nil
 }
 
-func (r OAIRepo) PostRun(assistantId string, threadId string) (*app.OAIRun, error) {
+func (r OAIRepo) PostRun(ctx context.Context, assistantId string, threadId string) (*app.OAIRun, error) {
 	body := []byte(fmt.Sprintf(`{"assistant_id": "%s"}`, assistantId))
 	url := fmt.Sprintf("https://api.openai.com/v1/threads/%s/runs", threadId)
 
-	record, err := request[app.OAIRun](context.TODO(), reqConfig{Method: "POST", Url: url, Headers: r.BaseHeaders, Body: body}, 200)
+	record, err := request[app.OAIRun](ctx, reqConfig{Method: "POST", Url: url, Headers: r.BaseHeaders, Body: body}, 200)
 
 	if err != nil {
 		return nil, err
@@ -37,10 +38,10 @@ func (r OAIRepo) PostRun(assistantId string, threadId string) (*app.OAIRun, erro
 	return record, nil
 }
 
-func (r OAIRepo) GetMsgs(threadId string) (*[]app.OAIMessage, error) {
+func (r OAIRepo) GetMsgs(ctx context.Context, threadId string) (*[]app.OAIMessage, error) {
 	url := fmt.Sprintf("https://api.openai.com/v1/threads/%s/messages", threadId)
 
-	msgs, err := request[app.OAIMessageListing](context.TODO(), reqConfig{Method: "GET", Url: url, Headers: r.BaseHeaders}, 200)
+	msgs, err := request[app.OAIMessageListing](ctx, reqConfig{Method: "GET", Url: url, Headers: r.BaseHeaders}, 200)
 
 	if err != nil {
 		return nil, err
@@ -49,11 +50,11 @@ func (r OAIRepo) GetMsgs(threadId string) (*[]app.OAIMessage, error) {
 	return &msgs.Data, nil
 }
 
-func (r OAIRepo) PostMsg(proto app.MessageProto, threadId string) error {
+func (r OAIRepo) PostMsg(ctx context.Context, proto app.MessageProto, threadId string) error {
 	body := []byte(fmt.Sprintf(`{"role": "%s", "content": %s}`, proto.Role, proto.Content))
 	url := fmt.Sprintf("https://api.openai.com/v1/threads/%s/messages", threadId)
 
-	_, err := request[app.OAIMessage](context.TODO(), reqConfig{Method: "POST", Url: url, Headers: r.BaseHeaders, Body: body}, 200)
+	_, err := request[app.OAIMessage](ctx, reqConfig{Method: "POST", Url: url, Headers: r.BaseHeaders, Body: body}, 200)
 
 	if err != nil {
 		return err
@@ -62,8 +63,8 @@ func (r OAIRepo) PostMsg(proto app.MessageProto, threadId string) error {
 	return nil
 }
 
-func (r OAIRepo) PostThread() (string, error) {
-	thread, err := request[app.OAIThread](context.TODO(), reqConfig{Method: "POST", Url: "https://api.openai.com/v1/threads", Headers: r.BaseHeaders}, 200)
+func (r OAIRepo) PostThread(ctx context.Context) (string, error) {
+	thread, err := request[app.OAIThread](ctx, reqConfig{Method: "POST", Url: "https://api.openai.com/v1/threads", Headers: r.BaseHeaders}, 200)
 
 	if err != nil {
 		return "", err
@@ -72,9 +73,9 @@ func (r OAIRepo) PostThread() (string, error) {
 	return thread.Id, nil
 }
 
-func (r OAIRepo) DeleteThread(threadId string) error {
+func (r OAIRepo) DeleteThread(ctx context.Context, threadId string) error {
 	url := fmt.Sprintf(`https://api.openai.com/v1/threads/%s`, threadId)
-	_, err := request[app.OAIThread](context.TODO(), reqConfig{Method: "DELETE", Url: url, Headers: r.BaseHeaders}, 200)
+	_, err := request[app.OAIThread](ctx, reqConfig{Method: "DELETE", Url: url, Headers: r.BaseHeaders}, 200)
 
 	if err != nil {
 		return err
@@ -82,3 +83,20 @@ func (r OAIRepo) DeleteThread(threadId string) error {
 
 	return nil
 }
+
+func (r OAIRepo) PostCompletion(ctx context.Context, proto app.CompletionProto) (*app.OAICompletion, error) {
+	body, err := json.Marshal(proto)
+
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := request[app.OAICompletion](ctx, reqConfig{Method: "POST", Url: "https://api.openai.com/v1/chat/completions",
+		Headers: r.BaseHeaders, Body: body}, 200)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
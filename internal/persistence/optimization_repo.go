@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 
 	"github.com/felixbrock/prompt-grammarly/internal/app"
 	"github.com/felixbrock/prompt-grammarly/internal/domain"
@@ -15,14 +16,14 @@ type OptimizationRepo struct {
 	BaseUrl     string
 }
 
-func (r OptimizationRepo) Insert(optimization domain.Optimization) error {
+func (r OptimizationRepo) Insert(ctx context.Context, optimization domain.Optimization) error {
 	body, err := json.Marshal(optimization)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = request[domain.Optimization](context.TODO(), reqConfig{
+	_, err = request[domain.Optimization](ctx, reqConfig{
 		Method:  "POST",
 		Url:     r.BaseUrl,
 		Body:    body,
@@ -36,14 +37,14 @@ func (r OptimizationRepo) Insert(optimization domain.Optimization) error {
 	return nil
 }
 
-func (r OptimizationRepo) Update(id string, opts app.OpUpdateOpts) error {
+func (r OptimizationRepo) Update(ctx context.Context, id string, opts app.OpUpdateOpts) error {
 	body, err := json.Marshal(opts)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = request[domain.Optimization](context.TODO(), reqConfig{
+	_, err = request[domain.Optimization](ctx, reqConfig{
 		Method:    "PATCH",
 		Url:       r.BaseUrl,
 		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
@@ -58,8 +59,38 @@ func (r OptimizationRepo) Update(id string, opts app.OpUpdateOpts) error {
 	return nil
 }
 
-func (r OptimizationRepo) Read(id string) (*domain.Optimization, error) {
-	records, err := request[[]domain.Optimization](context.TODO(), reqConfig{
+func (r OptimizationRepo) link(ctx context.Context, param string, libraryPromptId *string) error {
+	body, err := json.Marshal(map[string]*string{"library_prompt_id": libraryPromptId})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = request[domain.Optimization](ctx, reqConfig{
+		Method:    "PATCH",
+		Url:       r.BaseUrl,
+		UrlParams: []string{param},
+		Body:      body,
+		Headers:   append(r.BaseHeaders, "Content-Type:application/json")},
+		204)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r OptimizationRepo) Link(ctx context.Context, id string, libraryPromptId string) error {
+	return r.link(ctx, fmt.Sprintf("id=eq.%s", id), &libraryPromptId)
+}
+
+func (r OptimizationRepo) Unlink(ctx context.Context, libraryPromptId string) error {
+	return r.link(ctx, fmt.Sprintf("library_prompt_id=eq.%s", libraryPromptId), nil)
+}
+
+func (r OptimizationRepo) Read(ctx context.Context, id string) (*domain.Optimization, error) {
+	records, err := request[[]domain.Optimization](ctx, reqConfig{
 		Method:    "GET",
 		Url:       r.BaseUrl,
 		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
@@ -77,3 +108,76 @@ func (r OptimizationRepo) Read(id string) (*domain.Optimization, error) {
 
 	return &(*records)[0], nil
 }
+
+func (r OptimizationRepo) getFilterParams(filter app.OpReadFilter) []string {
+	params := []string{"order=created_at.desc"}
+
+	if filter.IdCond != "" {
+		params = append(params, fmt.Sprintf("id=%s", filter.IdCond))
+	}
+	if filter.ParentIdCond != "" {
+		params = append(params, fmt.Sprintf("parent_id=%s", filter.ParentIdCond))
+	}
+	if filter.SessionIdCond != "" {
+		params = append(params, fmt.Sprintf("session_id=%s", filter.SessionIdCond))
+	}
+	if filter.BatchIdCond != "" {
+		params = append(params, fmt.Sprintf("batch_id=%s", filter.BatchIdCond))
+	}
+	if filter.LibraryPromptIdCond != "" {
+		params = append(params, fmt.Sprintf("library_prompt_id=%s", filter.LibraryPromptIdCond))
+	}
+	if filter.AutoRunIdCond != "" {
+		params = append(params, fmt.Sprintf("auto_run_id=%s", filter.AutoRunIdCond))
+	}
+	for i := 0; i < len(filter.CreatedAtConds); i++ {
+		params = append(params, fmt.Sprintf("created_at=%s", filter.CreatedAtConds[i]))
+	}
+	if filter.SearchText != "" {
+		text := url.QueryEscape(filter.SearchText)
+		params = append(params, fmt.Sprintf(`or=(original_prompt.wfts(english)."%s",optimized_prompt.wfts(english)."%s",instructions.wfts(english)."%s")`,
+			text, text, text))
+	}
+	if filter.Limit > 0 {
+		params = append(params, fmt.Sprintf("limit=%d", filter.Limit))
+	}
+
+	return params
+}
+
+func (r OptimizationRepo) ReadMany(ctx context.Context, filter app.OpReadFilter) (*[]domain.Optimization, error) {
+	records, err := request[[]domain.Optimization](ctx, reqConfig{
+		Method:    "GET",
+		Url:       r.BaseUrl,
+		UrlParams: r.getFilterParams(filter),
+		Body:      nil,
+		Headers:   r.BaseHeaders},
+		200)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Detach turns the children of the matched optimizations into roots of their own lineage
+func (r OptimizationRepo) Detach(ctx context.Context, parentIdCond string) error {
+	_, err := request[domain.Optimization](ctx, reqConfig{
+		Method:    "PATCH",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("parent_id=%s", parentIdCond)},
+		Body:      []byte(`{"parent_id": null}`),
+		Headers:   append(r.BaseHeaders, "Content-Type:application/json")},
+		204)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r OptimizationRepo) Delete(ctx context.Context, idCond string) (int, error) {
+	return deleteRecords(ctx, r.BaseUrl, r.BaseHeaders, []string{fmt.Sprintf("id=%s", idCond)})
+}
@@ -10,7 +10,7 @@ type PHRepo struct {
 	ApiKey      string
 }
 
-func (r PHRepo) Capture(eventType string, opid string) error {
+func (r PHRepo) Capture(ctx context.Context, eventType string, opid string) error {
 	url := "https://eu.posthog.com/capture/"
 	body := []byte(fmt.Sprintf(`{
 		"api_key": "%s",
@@ -18,7 +18,7 @@ func (r PHRepo) Capture(eventType string, opid string) error {
 		"properties": {
 			"distinct_id": "%s"}}`, r.ApiKey, eventType, opid))
 
-	_, err := request[struct{}](context.TODO(), reqConfig{Method: "POST", Url: url, Headers: r.BaseHeaders, Body: body}, 200)
+	_, err := request[struct{}](ctx, reqConfig{Method: "POST", Url: url, Headers: r.BaseHeaders, Body: body}, 200)
 
 	if err != nil {
 		return err
@@ -0,0 +1,56 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+type ProfileRepo struct {
+	BaseHeaders []string
+	BaseUrl     string
+}
+
+func (r ProfileRepo) Upsert(ctx context.Context, profile domain.Profile) error {
+	body, err := json.Marshal(profile)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = request[domain.Profile](ctx, reqConfig{
+		Method:  "POST",
+		Url:     r.BaseUrl,
+		Body:    body,
+		Headers: append(r.BaseHeaders, "Content-Type:application/json", "Prefer:resolution=merge-duplicates")},
+		201)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r ProfileRepo) Read(ctx context.Context, sessionId string) (*domain.Profile, error) {
+	records, err := request[[]domain.Profile](ctx, reqConfig{
+		Method:    "GET",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("session_id=eq.%s", sessionId)},
+		Body:      nil,
+		Headers:   r.BaseHeaders},
+		200)
+
+	if err != nil {
+		return nil, err
+	} else if len(*records) == 0 {
+		return nil, nil
+	} else if len(*records) > 1 {
+		return nil, errors.New("multiple profiles found")
+	}
+
+	return &(*records)[0], nil
+}
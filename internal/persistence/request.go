@@ -5,9 +5,12 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/felixbrock/prompt-grammarly/internal/app"
+	"github.com/felixbrock/prompt-grammarly/internal/tracing"
 )
 
 type reqConfig struct {
@@ -23,9 +26,16 @@ func request[T any](ctx context.Context, config reqConfig, expectedResCode int)
 	if len(config.UrlParams) > 0 {
 		url = fmt.Sprintf("%s?%s", config.Url, strings.Join(config.UrlParams, "&"))
 	}
+	service, path := endpoint(config.Url)
+
+	ctx, span := tracing.StartClient(ctx, fmt.Sprintf("%s %s", config.Method, path),
+		tracing.String("service", service), tracing.String("http.method", config.Method), tracing.String("endpoint", path))
+	defer span.End()
+
 	req, err := http.NewRequestWithContext(ctx, config.Method, url, bytes.NewBuffer(config.Body))
 
 	if err != nil {
+		span.RecordError(err)
 		return nil, err
 	}
 
@@ -34,18 +44,30 @@ func request[T any](ctx context.Context, config reqConfig, expectedResCode int)
 		req.Header.Add(headerKV[0], headerKV[1])
 	}
 
+	start := time.Now()
+
 	resp, err := http.DefaultClient.Do(req)
 
+	externalDuration.Observe(time.Since(start).Seconds(), service, path, config.Method)
 	if err != nil {
+		externalCalls.Inc(service, path, config.Method, "error")
+		span.RecordError(err)
 		return nil, err
-	} else if resp.StatusCode != expectedResCode {
+	}
+
+	externalCalls.Inc(service, path, config.Method, strconv.Itoa(resp.StatusCode))
+	span.SetAttributes(tracing.Int("http.status_code", resp.StatusCode))
+	if resp.StatusCode != expectedResCode {
 		body, _ := app.Read(resp.Body)
-		return nil, fmt.Errorf("unexpected response status code error: %s", body)
+		err = fmt.Errorf("unexpected response status code error: %s", body)
+		span.RecordError(err)
+		return nil, err
 	}
 
 	body, err := app.Read(resp.Body)
 
 	if err != nil {
+		span.RecordError(err)
 		return nil, err
 	}
 
@@ -57,8 +79,32 @@ func request[T any](ctx context.Context, config reqConfig, expectedResCode int)
 	t, err = app.ReadJSON[T](body)
 
 	if err != nil {
+		span.RecordError(err)
 		return nil, err
 	}
 
 	return t, nil
 }
+
+type deletedRecord struct {
+	Id string `json:"id"`
+}
+
+// deleteRecords removes the records matching the params and returns how many were removed
+func deleteRecords(ctx context.Context, url string, headers []string, params []string) (int, error) {
+	records, err := request[[]deletedRecord](ctx, reqConfig{
+		Method:    "DELETE",
+		Url:       url,
+		UrlParams: append(params, "select=id"),
+		Body:      nil,
+		Headers:   append(headers, "Prefer:return=representation")},
+		200)
+
+	if err != nil {
+		return 0, err
+	} else if records == nil {
+		return 0, nil
+	}
+
+	return len(*records), nil
+}
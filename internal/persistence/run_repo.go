@@ -14,14 +14,14 @@ type RunRepo struct {
 	BaseUrl     string
 }
 
-func (r RunRepo) Insert(run domain.Run) error {
+func (r RunRepo) Insert(ctx context.Context, run domain.Run) error {
 	body, err := json.Marshal(run)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = request[domain.Run](context.TODO(), reqConfig{
+	_, err = request[domain.Run](ctx, reqConfig{
 		Method:  "POST",
 		Url:     r.BaseUrl,
 		Body:    body,
@@ -35,10 +35,10 @@ func (r RunRepo) Insert(run domain.Run) error {
 	return nil
 }
 
-func (r RunRepo) Update(id string, state string) error {
+func (r RunRepo) Update(ctx context.Context, id string, state string) error {
 	body := []byte(fmt.Sprintf(`{"state": "%s"}`, state))
 
-	_, err := request[domain.Run](context.TODO(), reqConfig{
+	_, err := request[domain.Run](ctx, reqConfig{
 		Method:    "PATCH",
 		Url:       r.BaseUrl,
 		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
@@ -53,8 +53,30 @@ func (r RunRepo) Update(id string, state string) error {
 	return nil
 }
 
-func (r RunRepo) Read(filter app.RunReadFilter) (*[]domain.Run, error) {
-	records, err := request[[]domain.Run](context.TODO(), reqConfig{
+func (r RunRepo) UpdateScores(ctx context.Context, id string, opts app.RunScoreOpts) error {
+	body, err := json.Marshal(opts)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = request[domain.Run](ctx, reqConfig{
+		Method:    "PATCH",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
+		Body:      body,
+		Headers:   append(r.BaseHeaders, "Content-Type:application/json")},
+		204)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r RunRepo) Read(ctx context.Context, filter app.RunReadFilter) (*[]domain.Run, error) {
+	records, err := request[[]domain.Run](ctx, reqConfig{
 		Method:    "GET",
 		Url:       r.BaseUrl,
 		UrlParams: []string{fmt.Sprintf("optimization_id=eq.%s", filter.OptimizationId)},
@@ -68,3 +90,7 @@ func (r RunRepo) Read(filter app.RunReadFilter) (*[]domain.Run, error) {
 
 	return records, nil
 }
+
+func (r RunRepo) Delete(ctx context.Context, opIdCond string) (int, error) {
+	return deleteRecords(ctx, r.BaseUrl, r.BaseHeaders, []string{fmt.Sprintf("optimization_id=%s", opIdCond)})
+}
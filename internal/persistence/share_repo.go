@@ -0,0 +1,86 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/felixbrock/prompt-grammarly/internal/domain"
+)
+
+type ShareRepo struct {
+	BaseHeaders []string
+	BaseUrl     string
+}
+
+func (r ShareRepo) Insert(ctx context.Context, share domain.Share) error {
+	body, err := json.Marshal(share)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = request[domain.Share](ctx, reqConfig{
+		Method:  "POST",
+		Url:     r.BaseUrl,
+		Body:    body,
+		Headers: append(r.BaseHeaders, "Content-Type:application/json")},
+		201)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r ShareRepo) Revoke(ctx context.Context, id string) error {
+	body := []byte(`{"revoked": true}`)
+
+	_, err := request[domain.Share](ctx, reqConfig{
+		Method:    "PATCH",
+		Url:       r.BaseUrl,
+		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
+		Body:      body,
+		Headers:   append(r.BaseHeaders, "Content-Type:application/json")},
+		204)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r ShareRepo) read(ctx context.Context, param string) (*domain.Share, error) {
+	records, err := request[[]domain.Share](ctx, reqConfig{
+		Method:    "GET",
+		Url:       r.BaseUrl,
+		UrlParams: []string{param},
+		Body:      nil,
+		Headers:   r.BaseHeaders},
+		200)
+
+	if err != nil {
+		return nil, err
+	} else if len(*records) == 0 {
+		return nil, errors.New("no share found")
+	} else if len(*records) > 1 {
+		return nil, errors.New("multiple shares found")
+	}
+
+	return &(*records)[0], nil
+}
+
+func (r ShareRepo) Read(ctx context.Context, id string) (*domain.Share, error) {
+	return r.read(ctx, fmt.Sprintf("id=eq.%s", id))
+}
+
+func (r ShareRepo) ReadByToken(ctx context.Context, tokenHash string) (*domain.Share, error) {
+	return r.read(ctx, fmt.Sprintf("token_hash=eq.%s", tokenHash))
+}
+
+func (r ShareRepo) Delete(ctx context.Context, opIdCond string) (int, error) {
+	return deleteRecords(ctx, r.BaseUrl, r.BaseHeaders, []string{fmt.Sprintf("optimization_id=%s", opIdCond)})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
 
 	"github.com/felixbrock/prompt-grammarly/internal/app"
 	"github.com/felixbrock/prompt-grammarly/internal/domain"
@@ -14,14 +15,14 @@ type SuggestionRepo struct {
 	BaseUrl     string
 }
 
-func (r SuggestionRepo) Insert(suggestions []domain.Suggestion) error {
+func (r SuggestionRepo) Insert(ctx context.Context, suggestions []domain.Suggestion) error {
 	body, err := json.Marshal(suggestions)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = request[domain.Suggestion](context.TODO(), reqConfig{
+	_, err = request[domain.Suggestion](ctx, reqConfig{
 		Method:  "POST",
 		Url:     r.BaseUrl,
 		Body:    body,
@@ -34,10 +35,10 @@ func (r SuggestionRepo) Insert(suggestions []domain.Suggestion) error {
 	return nil
 }
 
-func (r SuggestionRepo) Update(id string, userFeedback int16) error {
+func (r SuggestionRepo) Update(ctx context.Context, id string, userFeedback int16) error {
 	body := []byte(fmt.Sprintf(`{"user_feedback": %d}`, userFeedback))
 
-	_, err := request[domain.Suggestion](context.TODO(), reqConfig{
+	_, err := request[domain.Suggestion](ctx, reqConfig{
 		Method:    "PATCH",
 		Url:       r.BaseUrl,
 		UrlParams: []string{fmt.Sprintf("id=eq.%s", id)},
@@ -55,18 +56,37 @@ func (r SuggestionRepo) Update(id string, userFeedback int16) error {
 func (r SuggestionRepo) getFilterParams(filter app.SuggReadFilter) []string {
 	var params []string
 
+	if filter.IdCond != "" {
+		params = append(params, fmt.Sprintf("id=%s", filter.IdCond))
+	}
 	if filter.OpIdCond != "" {
 		params = append(params, fmt.Sprintf("optimization_id=%s", filter.OpIdCond))
 	}
 	if filter.UFeedbCond != "" {
 		params = append(params, fmt.Sprintf("user_feedback=%s", filter.UFeedbCond))
 	}
+	if filter.SeverityCond != "" {
+		params = append(params, fmt.Sprintf("severity=%s", filter.SeverityCond))
+	}
+	if filter.AnalyzersCond != "" {
+		params = append(params, fmt.Sprintf("analyzers=%s", filter.AnalyzersCond))
+	}
+	if filter.SessionIdCond != "" {
+		params = append(params, "select=*,optimization!inner(session_id)",
+			fmt.Sprintf("optimization.session_id=%s", filter.SessionIdCond))
+	}
+	if filter.SearchText != "" {
+		params = append(params, fmt.Sprintf("suggestion=wfts(english).%s", url.QueryEscape(filter.SearchText)))
+	}
+	if filter.Limit > 0 {
+		params = append(params, fmt.Sprintf("limit=%d", filter.Limit))
+	}
 
 	return params
 }
 
-func (r SuggestionRepo) Read(filter app.SuggReadFilter) (*[]domain.Suggestion, error) {
-	records, err := request[[]domain.Suggestion](context.TODO(), reqConfig{
+func (r SuggestionRepo) Read(ctx context.Context, filter app.SuggReadFilter) (*[]domain.Suggestion, error) {
+	records, err := request[[]domain.Suggestion](ctx, reqConfig{
 		Method:    "GET",
 		Url:       r.BaseUrl,
 		UrlParams: r.getFilterParams(filter),
@@ -80,3 +100,7 @@ func (r SuggestionRepo) Read(filter app.SuggReadFilter) (*[]domain.Suggestion, e
 
 	return records, nil
 }
+
+func (r SuggestionRepo) Delete(ctx context.Context, opIdCond string) (int, error) {
+	return deleteRecords(ctx, r.BaseUrl, r.BaseHeaders, []string{fmt.Sprintf("optimization_id=%s", opIdCond)})
+}
@@ -0,0 +1,180 @@
+package redact
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// matches returns the spans of a capture group of the pattern, 0 being the whole match
+func matches(re *regexp.Regexp, group int) func(text string) [][2]int {
+	return func(text string) [][2]int {
+		var spans [][2]int
+
+		found := re.FindAllStringSubmatchIndex(text, -1)
+		for i := 0; i < len(found); i++ {
+			start, end := found[i][2*group], found[i][2*group+1]
+			if start >= 0 {
+				spans = append(spans, [2]int{start, end})
+			}
+		}
+
+		return spans
+	}
+}
+
+var privateKey = Detector{
+	Kind: "private_key",
+	Find: matches(regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), 0),
+}
+
+// apiKey knows the formats of common providers, e.g. OpenAI, AWS, GitHub, Slack, Google and Stripe
+var apiKey = Detector{
+	Kind: "secret",
+	Find: matches(regexp.MustCompile(
+		`\b(?:sk-[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35}|[rs]k_live_[0-9A-Za-z]{24,})\b`), 0),
+}
+
+var jwt = Detector{
+	Kind: "secret",
+	Find: matches(regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\b`), 0),
+}
+
+// assignedSecret redacts the values of assignments like `password: hunter22`
+var assignedSecret = Detector{
+	Kind: "secret",
+	Find: matches(regexp.MustCompile(
+		`(?i)\b(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|client[_-]?secret)\b\s*[:=]\s*["']?([^\s"'{}]{5,}[^\s"'{}.,;:!?)\]])`), 1),
+}
+
+var email = Detector{
+	Kind: "email",
+	Find: matches(regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`), 0),
+}
+
+var cardCandidate = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+// cardNumber only redacts digit sequences passing the Luhn check
+var cardNumber = Detector{
+	Kind: "card",
+	Find: func(text string) [][2]int {
+		var spans [][2]int
+
+		found := cardCandidate.FindAllStringIndex(text, -1)
+		for i := 0; i < len(found); i++ {
+			if luhn(text[found[i][0]:found[i][1]]) {
+				spans = append(spans, [2]int{found[i][0], found[i][1]})
+			}
+		}
+
+		return spans
+	},
+}
+
+func luhn(number string) bool {
+	sum := 0
+	double := false
+
+	for i := len(number) - 1; i >= 0; i-- {
+		if number[i] < '0' || number[i] > '9' {
+			continue
+		}
+
+		digit := int(number[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+var phoneCandidate = regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,4}\)[ .-]?)?\d{2,4}[ .-]\d{3,4}(?:[ .-]?\d{2,4}){0,2}`)
+
+// phoneNumber requires an international prefix or area code in parentheses and at least seven
+// digits, so dates, versions and amounts aren't mistaken for phone numbers
+var phoneNumber = Detector{
+	Kind: "phone",
+	Find: func(text string) [][2]int {
+		var spans [][2]int
+
+		found := phoneCandidate.FindAllStringIndex(text, -1)
+		for i := 0; i < len(found); i++ {
+			candidate := text[found[i][0]:found[i][1]]
+			if (strings.HasPrefix(candidate, "+") || strings.HasPrefix(candidate, "(")) && digits(candidate) >= 7 {
+				spans = append(spans, [2]int{found[i][0], found[i][1]})
+			}
+		}
+
+		return spans
+	},
+}
+
+func digits(text string) int {
+	count := 0
+	for _, r := range text {
+		if unicode.IsDigit(r) {
+			count++
+		}
+	}
+
+	return count
+}
+
+const (
+	minEntropyTokenLength = 24
+	minEntropyBits        = 4.0
+)
+
+// entropyCandidate stops at slashes and hyphens, so paths, URLs, UUIDs and hyphenated ids are
+// split into their parts instead of being judged as a whole
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+_=]{24,}`)
+
+// highEntropy catches secrets of unknown formats: long tokens mixing upper and lower case letters
+// and digits whose characters are spread as evenly as those of random strings
+var highEntropy = Detector{
+	Kind: "secret",
+	Find: func(text string) [][2]int {
+		var spans [][2]int
+
+		found := entropyCandidate.FindAllStringIndex(text, -1)
+		for i := 0; i < len(found); i++ {
+			token := text[found[i][0]:found[i][1]]
+			if len(token) >= minEntropyTokenLength && mixedClasses(token) && entropy(token) >= minEntropyBits {
+				spans = append(spans, [2]int{found[i][0], found[i][1]})
+			}
+		}
+
+		return spans
+	},
+}
+
+// mixedClasses reports whether the token contains upper case letters, lower case letters and digits
+func mixedClasses(token string) bool {
+	return strings.IndexFunc(token, unicode.IsUpper) >= 0 && strings.IndexFunc(token, unicode.IsLower) >= 0 &&
+		strings.IndexFunc(token, unicode.IsDigit) >= 0
+}
+
+// entropy is the Shannon entropy of the token in bits per character
+func entropy(token string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range token {
+		counts[r]++
+	}
+
+	var bits float64
+	length := float64(len(token))
+	for _, count := range counts {
+		p := float64(count) / length
+		bits -= p * math.Log2(p)
+	}
+
+	return bits
+}
@@ -0,0 +1,53 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var placeholderPattern = regexp.MustCompile(`\[REDACTED_[A-Z_]+_[0-9]+\]`)
+
+// Map relates placeholders to the values they replace
+type Map map[string]string
+
+func (m Map) placeholder(kind string, value string) string {
+	count := 0
+	prefix := fmt.Sprintf("[REDACTED_%s_", strings.ToUpper(kind))
+
+	for placeholder, v := range m {
+		if v == value {
+			return placeholder
+		}
+		if strings.HasPrefix(placeholder, prefix) {
+			count++
+		}
+	}
+
+	placeholder := fmt.Sprintf("%s%d]", prefix, count+1)
+	m[placeholder] = value
+
+	return placeholder
+}
+
+// Restore replaces the placeholders of the text with the values they stand for. Placeholders the
+// map doesn't know are kept.
+func (m Map) Restore(text string) string {
+	if len(m) == 0 {
+		return text
+	}
+
+	placeholders := make([]string, 0, len(m))
+	for placeholder := range m {
+		placeholders = append(placeholders, placeholder)
+	}
+	sort.Strings(placeholders)
+
+	pairs := make([]string, 0, 2*len(placeholders))
+	for i := 0; i < len(placeholders); i++ {
+		pairs = append(pairs, placeholders[i], m[placeholders[i]])
+	}
+
+	return strings.NewReplacer(pairs...).Replace(text)
+}
@@ -0,0 +1,60 @@
+package redact
+
+import "testing"
+
+func TestPlaceholder(t *testing.T) {
+	m := Map{}
+
+	if got := m.placeholder("email", "a@example.com"); got != "[REDACTED_EMAIL_1]" {
+		t.Errorf("got %s", got)
+	}
+	if got := m.placeholder("secret", "hunter22"); got != "[REDACTED_SECRET_1]" {
+		t.Errorf("got %s", got)
+	}
+	if got := m.placeholder("email", "b@example.com"); got != "[REDACTED_EMAIL_2]" {
+		t.Errorf("got %s", got)
+	}
+	if got := m.placeholder("email", "a@example.com"); got != "[REDACTED_EMAIL_1]" {
+		t.Errorf("known values have to keep their placeholder, got %s", got)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	redactor, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"several kinds", "Mail jane@example.com, call +1 415 555 2671 and use sk-abcdefghijklmnopqrstuvwx123."},
+		{"repeated value", "a@example.com and a@example.com"},
+		{"nothing to redact", "Summarize the text in three bullet points."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Map{}
+			redacted := redactor.Redact(tt.text, m)
+
+			if got := m.Restore(redacted); got != tt.text {
+				t.Errorf("got %q, want %q", got, tt.text)
+			}
+		})
+	}
+
+	// values of the same prompt's versions keep their placeholders and the map keeps numbering
+	m := Map{}
+	first := redactor.Redact("Mail a@example.com.", m)
+	second := redactor.Redact("Mail b@example.com, not a@example.com.", m)
+	if first != "Mail [REDACTED_EMAIL_1]." || second != "Mail [REDACTED_EMAIL_2], not [REDACTED_EMAIL_1]." {
+		t.Errorf("got %q and %q", first, second)
+	}
+
+	m = Map{"[REDACTED_SECRET_1]": "one", "[REDACTED_SECRET_10]": "ten"}
+	if got := m.Restore("[REDACTED_SECRET_10] [REDACTED_SECRET_1] [REDACTED_SECRET_2]"); got != "ten one [REDACTED_SECRET_2]" {
+		t.Errorf("got %q", got)
+	}
+}
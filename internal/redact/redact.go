@@ -0,0 +1,129 @@
+// Package redact replaces sensitive spans of prompts, e.g. API keys and email addresses, with
+// stable placeholders, so prompts can be stored and sent to models without them.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Detector finds spans of a kind of sensitive data. Spans are start and end byte offsets.
+type Detector struct {
+	Kind string
+	Find func(text string) [][2]int
+}
+
+// Detectors are the built-in detectors. If spans of several detectors overlap, the earlier
+// detector wins.
+var Detectors = []Detector{
+	privateKey,
+	apiKey,
+	jwt,
+	assignedSecret,
+	email,
+	cardNumber,
+	phoneNumber,
+	highEntropy,
+}
+
+type Redactor struct {
+	detectors []Detector
+}
+
+// New returns a redactor running the built-in detectors and one detector per custom pattern
+func New(patterns []string) (*Redactor, error) {
+	redactor := Redactor{detectors: append([]Detector{}, Detectors...)}
+
+	for i := 0; i < len(patterns); i++ {
+		re, err := regexp.Compile(patterns[i])
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %s: %w", patterns[i], err)
+		}
+
+		redactor.detectors = append(redactor.detectors, Detector{Kind: "custom", Find: matches(re, 0)})
+	}
+
+	return &redactor, nil
+}
+
+// ParsePatterns reads a JSON array of regular expressions
+func ParsePatterns(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+
+	var patterns []string
+	if err := json.Unmarshal([]byte(list), &patterns); err != nil {
+		return nil, fmt.Errorf("redaction patterns have to be a JSON array of strings: %w", err)
+	}
+
+	return patterns, nil
+}
+
+// Redact replaces the sensitive spans of the text with placeholders. Values already in the map
+// keep their placeholder, new values are added to it.
+func (r Redactor) Redact(text string, m Map) string {
+	var spans []span
+	for i := 0; i < len(r.detectors); i++ {
+		found := r.detectors[i].Find(text)
+
+		for j := 0; j < len(found); j++ {
+			candidate := span{start: found[j][0], end: found[j][1], kind: r.detectors[i].Kind}
+			if candidate.end > candidate.start && !overlaps(spans, candidate) && !isPlaceholder(text, candidate) {
+				spans = append(spans, candidate)
+			}
+		}
+	}
+
+	if len(spans) == 0 {
+		return text
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(spans); i++ {
+		b.WriteString(text[last:spans[i].start])
+		b.WriteString(m.placeholder(spans[i].kind, text[spans[i].start:spans[i].end]))
+		last = spans[i].end
+	}
+	b.WriteString(text[last:])
+
+	return b.String()
+}
+
+type span struct {
+	start int
+	end   int
+	kind  string
+}
+
+func overlaps(spans []span, candidate span) bool {
+	for i := 0; i < len(spans); i++ {
+		if candidate.start < spans[i].end && spans[i].start < candidate.end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPlaceholder prevents placeholders of earlier redactions from being redacted again
+func isPlaceholder(text string, s span) bool {
+	loc := placeholderPattern.FindAllStringIndex(text, -1)
+
+	for i := 0; i < len(loc); i++ {
+		if s.start < loc[i][1] && loc[i][0] < s.end {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+package redact
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ParseKey decodes a base64 encoded AES-256 key
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return nil, fmt.Errorf("redaction key has to be base64 encoded: %w", err)
+	} else if len(key) != 32 {
+		return nil, fmt.Errorf("redaction key has to be 32 bytes long, got %d", len(key))
+	}
+
+	return key, nil
+}
+
+// Seal encrypts the map with AES-GCM, so the redacted values aren't stored in plain text
+func Seal(key []byte, m Map) (string, error) {
+	if len(m) == 0 {
+		return "", nil
+	}
+
+	plain, err := json.Marshal(m)
+
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// Open decrypts a map sealed with the same key
+func Open(key []byte, sealed string) (Map, error) {
+	m := Map{}
+	if sealed == "" {
+		return m, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("sealed redaction map is too short")
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(plain, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
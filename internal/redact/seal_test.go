@@ -0,0 +1,80 @@
+package redact
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return []byte(strings.Repeat(string(b), 32))
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{"valid", base64.StdEncoding.EncodeToString(testKey('k')), false},
+		{"not base64", "not a key!", true},
+		{"too short", base64.StdEncoding.EncodeToString([]byte("short")), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKey(tt.encoded)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	m := Map{"[REDACTED_EMAIL_1]": "jane@example.com", "[REDACTED_SECRET_1]": "hunter22"}
+
+	sealed, err := Seal(testKey('k'), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "hunter22") {
+		t.Fatal("sealed map contains a value in plain text")
+	}
+
+	opened, err := Open(testKey('k'), sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(opened, m) {
+		t.Errorf("got %v, want %v", opened, m)
+	}
+
+	if _, err := Open(testKey('x'), sealed); err == nil {
+		t.Error("expected an error opening the map with a wrong key")
+	}
+
+	data, _ := base64.StdEncoding.DecodeString(sealed)
+	data[len(data)-1] ^= 1
+	if _, err := Open(testKey('k'), base64.StdEncoding.EncodeToString(data)); err == nil {
+		t.Error("expected an error opening a tampered map")
+	}
+
+	if _, err := Open(testKey('k'), base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("expected an error opening a truncated map")
+	}
+}
+
+func TestSealEmpty(t *testing.T) {
+	sealed, err := Seal(testKey('k'), Map{})
+	if err != nil || sealed != "" {
+		t.Fatalf("got %q, %v for an empty map", sealed, err)
+	}
+
+	opened, err := Open(testKey('k'), "")
+	if err != nil || len(opened) != 0 {
+		t.Errorf("got %v, %v for an empty sealed map", opened, err)
+	}
+}
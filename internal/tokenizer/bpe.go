@@ -0,0 +1,98 @@
+package tokenizer
+
+import (
+	"math"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// pieces splits text into the pieces that are encoded separately. A whitespace run matched by the
+// capturing `(\s+)` alternative and followed by other text leaves its last character to the next
+// piece, which emulates `\s+(?!\S)`. Runs matched by `\s*[\r\n]+` are kept whole.
+func pieces(pattern *regexp.Regexp, text string) []string {
+	var result []string
+
+	for start := 0; start < len(text); {
+		loc := pattern.FindStringSubmatchIndex(text[start:])
+		if loc == nil || loc[1] == 0 {
+			// the patterns match every character, this only guards against endless loops
+			_, size := utf8.DecodeRuneInString(text[start:])
+			result = append(result, text[start:start+size])
+			start += size
+			continue
+		}
+
+		if loc[0] > 0 {
+			result = append(result, text[start:start+loc[0]])
+		}
+
+		end := start + loc[1]
+		piece := text[start+loc[0] : end]
+		spaces := len(loc) > 2 && loc[2] >= 0
+
+		if spaces && end < len(text) && utf8.RuneCountInString(piece) > 1 {
+			next, _ := utf8.DecodeRuneInString(text[end:])
+			if !unicode.IsSpace(next) {
+				_, size := utf8.DecodeLastRuneInString(piece)
+				piece = piece[:len(piece)-size]
+				end -= size
+			}
+		}
+
+		result = append(result, piece)
+		start = end
+	}
+
+	return result
+}
+
+// bytePairEncode merges the bytes of a piece, always merging the adjacent parts with the lowest
+// rank first, until no merge is known
+func bytePairEncode(piece []byte, ranks map[string]int) []int {
+	// boundaries[i] is the start of the i-th part
+	boundaries := make([]int, len(piece)+1)
+	for i := 0; i <= len(piece); i++ {
+		boundaries[i] = i
+	}
+
+	rankOf := func(i int) int {
+		if i+2 >= len(boundaries) {
+			return math.MaxInt
+		}
+
+		if rank, ok := ranks[string(piece[boundaries[i]:boundaries[i+2]])]; ok {
+			return rank
+		}
+
+		return math.MaxInt
+	}
+
+	for len(boundaries) > 2 {
+		minRank, minIndex := math.MaxInt, -1
+		for i := 0; i < len(boundaries)-2; i++ {
+			if rank := rankOf(i); rank < minRank {
+				minRank, minIndex = rank, i
+			}
+		}
+
+		if minIndex == -1 {
+			break
+		}
+
+		boundaries = append(boundaries[:minIndex+1], boundaries[minIndex+2:]...)
+	}
+
+	tokens := make([]int, 0, len(boundaries)-1)
+	for i := 0; i < len(boundaries)-1; i++ {
+		part := string(piece[boundaries[i]:boundaries[i+1]])
+		if rank, ok := ranks[part]; ok {
+			tokens = append(tokens, rank)
+		} else {
+			// every single byte has a rank in valid rank files
+			tokens = append(tokens, -1)
+		}
+	}
+
+	return tokens
+}
@@ -0,0 +1,88 @@
+package tokenizer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// The expected pieces and counts are those of tiktoken for the same text
+func TestPieces(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		text     string
+		pieces   []string
+	}{
+		{"newline run", "cl100k_base", "a\n\n\nb", []string{"a", "\n\n\n", "b"}},
+		{"spaces before a word", "cl100k_base", "hello   world", []string{"hello", "  ", " world"}},
+		{"spaces around a newline", "cl100k_base", "a  \n  b", []string{"a", "  \n", " ", " b"}},
+		{"trailing spaces", "cl100k_base", "end  ", []string{"end", "  "}},
+		{"trailing newline", "cl100k_base", "x\n", []string{"x", "\n"}},
+		{"punctuation", "cl100k_base", "Hello, world!", []string{"Hello", ",", " world", "!"}},
+		{"numbers", "cl100k_base", "12345", []string{"123", "45"}},
+		{"newline run", "o200k_base", "a\n\n\nb", []string{"a", "\n\n\n", "b"}},
+		{"newline run without newline alternative", "r50k_base", "a\n\n\nb", []string{"a", "\n\n", "\n", "b"}},
+		{"spaces before a word", "r50k_base", "hello   world", []string{"hello", "  ", " world"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoding+" "+tt.name, func(t *testing.T) {
+			got := pieces(regexp.MustCompile(patterns[tt.encoding]), tt.text)
+
+			if !reflect.DeepEqual(got, tt.pieces) {
+				t.Errorf("got %q, want %q", got, tt.pieces)
+			}
+		})
+	}
+}
+
+func TestBytePairEncode(t *testing.T) {
+	ranks := map[string]int{"a": 0, "b": 1, "c": 2, "ab": 3, "bc": 4, "abc": 5}
+
+	if got := bytePairEncode([]byte("abc"), ranks); !reflect.DeepEqual(got, []int{5}) {
+		t.Errorf("got %v, want [5]", got)
+	}
+	if got := bytePairEncode([]byte("cab"), ranks); !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Errorf("got %v, want [2 3]", got)
+	}
+}
+
+// TestCount needs the rank files, which aren't part of the source. They are read from
+// TOKENIZER_DIR or static/tokenizer.
+func TestCount(t *testing.T) {
+	dir := os.Getenv("TOKENIZER_DIR")
+	if dir == "" {
+		dir = filepath.Join("..", "..", "static", "tokenizer")
+	}
+
+	tests := []struct {
+		encoding string
+		text     string
+		tokens   int
+	}{
+		{"cl100k_base", "hello world", 2},
+		{"cl100k_base", "tiktoken is great!", 6},
+		{"cl100k_base", "a\n\n\nb", 3},
+		{"r50k_base", "hello world", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoding+" "+tt.text, func(t *testing.T) {
+			if _, err := os.Stat(filepath.Join(dir, tt.encoding+".tiktoken")); err != nil {
+				t.Skipf("no rank file for %s in %s", tt.encoding, dir)
+			}
+
+			encoding, err := Load(dir, tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := encoding.Count(tt.text); got != tt.tokens {
+				t.Errorf("got %d tokens, want %d", got, tt.tokens)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+// Package tokenizer counts tokens the way OpenAI models do. It implements byte pair encoding for
+// the tiktoken rank files, which are read from a directory as they are too large to ship with the
+// source.
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Encoding struct {
+	Name    string
+	pattern *regexp.Regexp
+	ranks   map[string]int
+}
+
+// Go's regexp doesn't support lookaheads, so the `\s+(?!\S)|\s+` alternatives of the tiktoken
+// patterns are reduced to `(\s+)` and split afterwards, see pieces. It is the only capturing group.
+var patterns = map[string]string{
+	"r50k_base": `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|(\s+)`,
+	"p50k_base": `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|(\s+)`,
+	"cl100k_base": `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|` +
+		`\s*[\r\n]+|(\s+)`,
+	"o200k_base": `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|(\s+)`,
+}
+
+// modelPrefixes maps model names to their encoding. More specific prefixes come first.
+var modelPrefixes = []struct {
+	Prefix   string
+	Encoding string
+}{
+	{Prefix: "gpt-4o", Encoding: "o200k_base"},
+	{Prefix: "gpt-4", Encoding: "cl100k_base"},
+	{Prefix: "gpt-3.5", Encoding: "cl100k_base"},
+	{Prefix: "text-embedding", Encoding: "cl100k_base"},
+	{Prefix: "text-davinci-00", Encoding: "p50k_base"},
+	{Prefix: "code-davinci", Encoding: "p50k_base"},
+	{Prefix: "davinci", Encoding: "r50k_base"},
+	{Prefix: "curie", Encoding: "r50k_base"},
+	{Prefix: "babbage", Encoding: "r50k_base"},
+	{Prefix: "ada", Encoding: "r50k_base"},
+}
+
+// EncodingForModel returns the name of the encoding the model uses
+func EncodingForModel(model string) (string, error) {
+	for i := 0; i < len(modelPrefixes); i++ {
+		if strings.HasPrefix(model, modelPrefixes[i].Prefix) {
+			return modelPrefixes[i].Encoding, nil
+		}
+	}
+
+	return "", fmt.Errorf("no known encoding for model %s", model)
+}
+
+type cacheEntry struct {
+	encoding *Encoding
+	err      error
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[string]cacheEntry)
+)
+
+// Load reads the rank file <name>.tiktoken from dir. Encodings are cached, including failures to
+// read them, so the file is read once per process.
+func Load(dir string, name string) (*Encoding, error) {
+	pattern, ok := patterns[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %s", name)
+	}
+
+	path := filepath.Join(dir, name+".tiktoken")
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	if entry, ok := cache[path]; ok {
+		return entry.encoding, entry.err
+	}
+
+	ranks, err := readRanks(path)
+
+	if err != nil {
+		cache[path] = cacheEntry{err: err}
+		return nil, err
+	}
+
+	encoding := &Encoding{Name: name, pattern: regexp.MustCompile(pattern), ranks: ranks}
+	cache[path] = cacheEntry{encoding: encoding}
+
+	slog.Info("Loaded encoding", "encoding", name, "tokens", len(ranks))
+
+	return encoding, nil
+}
+
+func readRanks(path string) (map[string]int, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ranks := make(map[string]int)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, errors.New("malformed rank file")
+		}
+
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+
+		if err != nil {
+			return nil, err
+		}
+
+		rank, err := strconv.Atoi(fields[1])
+
+		if err != nil {
+			return nil, err
+		}
+
+		ranks[string(token)] = rank
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ranks, nil
+}
+
+// Encode returns the token ids of text. Special tokens like <|endoftext|> are encoded as text.
+func (e *Encoding) Encode(text string) []int {
+	var tokens []int
+
+	all := pieces(e.pattern, text)
+	for i := 0; i < len(all); i++ {
+		if rank, ok := e.ranks[all[i]]; ok {
+			tokens = append(tokens, rank)
+			continue
+		}
+
+		tokens = append(tokens, bytePairEncode([]byte(all[i]), e.ranks)...)
+	}
+
+	return tokens
+}
+
+func (e *Encoding) Count(text string) int {
+	return len(e.Encode(text))
+}
+
+// Estimate approximates the token count of text without an encoding. It splits text like
+// cl100k_base and assumes about four bytes per token for longer pieces.
+func Estimate(text string) int {
+	count := 0
+
+	all := pieces(estimatePattern, text)
+	for i := 0; i < len(all); i++ {
+		count += (len(all[i]) + 3) / 4
+	}
+
+	return count
+}
+
+var estimatePattern = regexp.MustCompile(patterns["cl100k_base"])
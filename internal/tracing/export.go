@@ -0,0 +1,338 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize     = 2048
+	batchSize     = 512
+	flushInterval = 5 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+type Exporter interface {
+	Export(ctx context.Context, service string, spans []SpanData) error
+}
+
+type processor struct {
+	service  string
+	exporter Exporter
+	queue    chan SpanData
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var (
+	mu     sync.RWMutex
+	active *processor
+)
+
+func current() *processor {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return active
+}
+
+// Configure enables tracing, finished spans are exported every few seconds or once a batch is full
+func Configure(service string, exporter Exporter) {
+	p := &processor{service: service, exporter: exporter, queue: make(chan SpanData, queueSize),
+		stop: make(chan struct{}), done: make(chan struct{})}
+
+	mu.Lock()
+	active = p
+	mu.Unlock()
+
+	go p.run()
+}
+
+// Shutdown stops recording spans and exports the queued ones. It returns once they are exported
+// or the context is done.
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	p := active
+	active = nil
+	mu.Unlock()
+
+	if p == nil {
+		return nil
+	}
+
+	close(p.stop)
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueue drops spans while the queue is full rather than blocking the traced code
+func (p *processor) enqueue(span SpanData) {
+	select {
+	case p.queue <- span:
+	default:
+	}
+}
+
+func (p *processor) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, batchSize)
+	for {
+		select {
+		case span := <-p.queue:
+			batch = append(batch, span)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-p.stop:
+			p.flush(batch)
+			close(p.done)
+			return
+		}
+
+		p.export(batch)
+		batch = make([]SpanData, 0, batchSize)
+	}
+}
+
+// flush exports the batch and the spans still queued
+func (p *processor) flush(batch []SpanData) {
+	for {
+		select {
+		case span := <-p.queue:
+			batch = append(batch, span)
+			if len(batch) < batchSize {
+				continue
+			}
+		default:
+			if len(batch) > 0 {
+				p.export(batch)
+			}
+			return
+		}
+
+		p.export(batch)
+		batch = make([]SpanData, 0, batchSize)
+	}
+}
+
+func (p *processor) export(batch []SpanData) {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	if err := p.exporter.Export(ctx, p.service, batch); err != nil {
+		slog.Warn("Exporting spans failed", "spans", len(batch), "error", err)
+	}
+}
+
+// StdoutExporter writes one JSON line per span, meant for local development
+type StdoutExporter struct {
+	W io.Writer
+}
+
+type stdoutSpan struct {
+	Service    string         `json:"service"`
+	TraceId    string         `json:"trace_id"`
+	SpanId     string         `json:"span_id"`
+	ParentId   string         `json:"parent_span_id,omitempty"`
+	Name       string         `json:"name"`
+	Kind       string         `json:"kind"`
+	Start      time.Time      `json:"start"`
+	DurationMs float64        `json:"duration_ms"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+func (e StdoutExporter) Export(ctx context.Context, service string, spans []SpanData) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+
+	for i := 0; i < len(spans); i++ {
+		s := stdoutSpan{
+			Service:    service,
+			TraceId:    spans[i].TraceId.String(),
+			SpanId:     spans[i].SpanId.String(),
+			Name:       spans[i].Name,
+			Kind:       spans[i].Kind.String(),
+			Start:      spans[i].Start,
+			DurationMs: float64(spans[i].End.Sub(spans[i].Start).Microseconds()) / 1000,
+			Error:      spans[i].Err,
+		}
+		if spans[i].ParentId.valid() {
+			s.ParentId = spans[i].ParentId.String()
+		}
+		if len(spans[i].Attrs) > 0 {
+			s.Attributes = make(map[string]any, len(spans[i].Attrs))
+			for j := 0; j < len(spans[i].Attrs); j++ {
+				s.Attributes[spans[i].Attrs[j].Key] = spans[i].Attrs[j].Value
+			}
+		}
+
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+
+	_, err := e.W.Write(b.Bytes())
+	return err
+}
+
+// OTLPExporter sends spans to the /v1/traces endpoint of a collector with the JSON encoding of
+// OTLP over HTTP. It doesn't use the repositories' request helper, which is itself traced.
+type OTLPExporter struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId           string     `json:"traceId"`
+	SpanId            string     `json:"spanId"`
+	ParentSpanId      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// The status codes of OTLP, unset spans are treated as successful
+const (
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+func toOtlpAttr(attr Attr) otlpAttr {
+	var value otlpValue
+
+	switch v := attr.Value.(type) {
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		value.IntValue = &s
+	case bool:
+		value.BoolValue = &v
+	case string:
+		value.StringValue = &v
+	default:
+		s := fmt.Sprint(v)
+		value.StringValue = &s
+	}
+
+	return otlpAttr{Key: attr.Key, Value: value}
+}
+
+func (e OTLPExporter) Export(ctx context.Context, service string, spans []SpanData) error {
+	converted := make([]otlpSpan, 0, len(spans))
+	for i := 0; i < len(spans); i++ {
+		s := otlpSpan{
+			TraceId:           spans[i].TraceId.String(),
+			SpanId:            spans[i].SpanId.String(),
+			Name:              spans[i].Name,
+			Kind:              int(spans[i].Kind),
+			StartTimeUnixNano: strconv.FormatInt(spans[i].Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(spans[i].End.UnixNano(), 10),
+			Status:            otlpStatus{Code: otlpStatusUnset},
+		}
+		if spans[i].ParentId.valid() {
+			s.ParentSpanId = spans[i].ParentId.String()
+		}
+		if spans[i].Err != "" {
+			s.Status = otlpStatus{Code: otlpStatusError, Message: spans[i].Err}
+		}
+		for j := 0; j < len(spans[i].Attrs); j++ {
+			s.Attributes = append(s.Attributes, toOtlpAttr(spans[i].Attrs[j]))
+		}
+
+		converted = append(converted, s)
+	}
+
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttr{toOtlpAttr(String("service.name", service))}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: service}, Spans: converted}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/v1/traces", strings.TrimSuffix(e.Endpoint, "/"))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector responded with status %d: %s", resp.StatusCode, msg)
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+// Package tracing records spans of requests, optimizations and external calls and exports them in
+// batches to stdout or an OpenTelemetry collector. Until Configure is called no spans are recorded.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Kind int
+
+// The values of the kinds match the OTLP span kinds
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindServer:
+		return "server"
+	case KindClient:
+		return "client"
+	default:
+		return "internal"
+	}
+}
+
+type Attr struct {
+	Key   string
+	Value any
+}
+
+func String(key string, value string) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+func Int(key string, value int) Attr {
+	return Attr{Key: key, Value: int64(value)}
+}
+
+func Bool(key string, value bool) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+type TraceId [16]byte
+type SpanId [8]byte
+
+func (id TraceId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceId) valid() bool {
+	return id != TraceId{}
+}
+
+func (id SpanId) valid() bool {
+	return id != SpanId{}
+}
+
+// SpanData is the finished state of a span handed to exporters
+type SpanData struct {
+	TraceId  TraceId
+	SpanId   SpanId
+	ParentId SpanId
+	Name     string
+	Kind     Kind
+	Start    time.Time
+	End      time.Time
+	Attrs    []Attr
+	Err      string
+}
+
+// Span is safe for concurrent use, all methods are no-ops on a nil span, which is what Start
+// returns while tracing is disabled
+type Span struct {
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Attrs = append(s.data.Attrs, attrs...)
+}
+
+// RecordError marks the span as failed, a nil error is ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Err = err.Error()
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	data.Attrs = append([]Attr{}, s.data.Attrs...)
+	s.mu.Unlock()
+
+	if p := current(); p != nil {
+		p.enqueue(data)
+	}
+}
+
+// TraceId is empty for a nil span
+func (s *Span) TraceId() string {
+	if s == nil {
+		return ""
+	}
+
+	return s.data.TraceId.String()
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the current span of the context, nil if there is none
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start begins an internal span as a child of the current span of the context
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return start(ctx, name, KindInternal, TraceId{}, SpanId{}, attrs)
+}
+
+// StartClient begins a span for a call to an external service
+func StartClient(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return start(ctx, name, KindClient, TraceId{}, SpanId{}, attrs)
+}
+
+// StartServer begins the span of an incoming request, continuing the trace of a valid W3C
+// traceparent header
+func StartServer(ctx context.Context, name string, traceparent string, attrs ...Attr) (context.Context, *Span) {
+	traceId, parentId, _ := parseTraceparent(traceparent)
+	return start(ctx, name, KindServer, traceId, parentId, attrs)
+}
+
+func start(ctx context.Context, name string, kind Kind, traceId TraceId, parentId SpanId, attrs []Attr) (context.Context, *Span) {
+	if current() == nil {
+		return ctx, nil
+	}
+
+	if parent := SpanFromContext(ctx); parent != nil && !traceId.valid() {
+		traceId = parent.data.TraceId
+		parentId = parent.data.SpanId
+	}
+	if !traceId.valid() {
+		rand.Read(traceId[:])
+	}
+
+	var spanId SpanId
+	rand.Read(spanId[:])
+
+	s := &Span{data: SpanData{
+		TraceId:  traceId,
+		SpanId:   spanId,
+		ParentId: parentId,
+		Name:     name,
+		Kind:     kind,
+		Start:    time.Now(),
+		Attrs:    attrs,
+	}}
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// parseTraceparent reads headers of the format 00-<trace id>-<parent id>-<flags>
+func parseTraceparent(header string) (TraceId, SpanId, bool) {
+	var traceId TraceId
+	var parentId SpanId
+
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return traceId, parentId, false
+	}
+
+	t, err := hex.DecodeString(parts[1])
+	if err != nil || len(t) != len(traceId) {
+		return traceId, parentId, false
+	}
+	p, err := hex.DecodeString(parts[2])
+	if err != nil || len(p) != len(parentId) {
+		return traceId, parentId, false
+	}
+
+	copy(traceId[:], t)
+	copy(parentId[:], p)
+	if !traceId.valid() || !parentId.valid() {
+		return TraceId{}, SpanId{}, false
+	}
+
+	return traceId, parentId, true
+}
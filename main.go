@@ -1,24 +1,54 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/felixbrock/prompt-grammarly/internal/app"
 	"github.com/felixbrock/prompt-grammarly/internal/component"
+	"github.com/felixbrock/prompt-grammarly/internal/lint"
 	"github.com/felixbrock/prompt-grammarly/internal/persistence"
+	"github.com/felixbrock/prompt-grammarly/internal/redact"
+	"github.com/felixbrock/prompt-grammarly/internal/tracing"
 	_ "go.uber.org/automaxprocs"
 )
 
+const (
+	defaultGoodShotLimit    = 3
+	defaultWrongShotLimit   = 10
+	defaultShareTTLHours    = 7 * 24
+	defaultBatchConcurrency = 2
+	defaultRetentionDays    = 90
+	defaultEvalModel        = "gpt-3.5-turbo"
+	defaultJudgeModel       = "gpt-4-turbo-preview"
+	defaultTokenizerDir     = "static/tokenizer"
+	defaultTokenizerModel   = "gpt-4"
+	defaultServiceName      = "prompt-grammarly"
+)
+
 func devConfig() (*app.Config, error) {
 	env, err := os.ReadFile("env.json")
 	if err != nil {
 		return nil, err
 	}
 
-	var config app.Config
+	config := app.Config{
+		GoodShotLimit:    defaultGoodShotLimit,
+		WrongShotLimit:   defaultWrongShotLimit,
+		ShareTTLHours:    defaultShareTTLHours,
+		BatchConcurrency: defaultBatchConcurrency,
+		RetentionDays:    defaultRetentionDays,
+		EvalModel:        defaultEvalModel,
+		JudgeModel:       defaultJudgeModel,
+		TokenizerDir:     defaultTokenizerDir,
+		TokenizerModel:   defaultTokenizerModel,
+		ServiceName:      defaultServiceName,
+	}
 	if err := json.Unmarshal(env, &config); err != nil {
 		return nil, err
 	}
@@ -37,14 +67,87 @@ func devHandler() {
 	baseHandler(config)
 }
 
+func envInt(key string, fallback int) (int, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback, nil
+	}
+
+	return strconv.Atoi(val)
+}
+
+func envBool(key string, fallback bool) (bool, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback, nil
+	}
+
+	return strconv.ParseBool(val)
+}
+
+func envString(key string, fallback string) string {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+
+	return val
+}
+
 func prodConfig() (*app.Config, error) {
+	goodShotLimit, err := envInt("GOOD_SHOT_LIMIT", defaultGoodShotLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	wrongShotLimit, err := envInt("WRONG_SHOT_LIMIT", defaultWrongShotLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	shareTTLHours, err := envInt("SHARE_TTL_HOURS", defaultShareTTLHours)
+	if err != nil {
+		return nil, err
+	}
+
+	batchConcurrency, err := envInt("BATCH_CONCURRENCY", defaultBatchConcurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	retentionDays, err := envInt("RETENTION_DAYS", defaultRetentionDays)
+	if err != nil {
+		return nil, err
+	}
+
+	redactionDisabled, err := envBool("REDACTION_DISABLED", false)
+	if err != nil {
+		return nil, err
+	}
+
 	config := app.Config{
-		Env:       os.Getenv("ENV"),
-		Port:      os.Getenv("PORT"),
-		DBApiKey:  os.Getenv("DB_API_KEY"),
-		DBUrl:     os.Getenv("DB_URL"),
-		OAIApiKey: os.Getenv("OAI_API_KEY"),
-		PHApiKey:  os.Getenv("PH_API_KEY"),
+		Env:               os.Getenv("ENV"),
+		Port:              os.Getenv("PORT"),
+		DBApiKey:          os.Getenv("DB_API_KEY"),
+		DBUrl:             os.Getenv("DB_URL"),
+		OAIApiKey:         os.Getenv("OAI_API_KEY"),
+		PHApiKey:          os.Getenv("PH_API_KEY"),
+		GoodShotLimit:     goodShotLimit,
+		WrongShotLimit:    wrongShotLimit,
+		ShareTTLHours:     shareTTLHours,
+		BatchConcurrency:  batchConcurrency,
+		RetentionDays:     retentionDays,
+		EvalModel:         envString("EVAL_MODEL", defaultEvalModel),
+		JudgeModel:        envString("JUDGE_MODEL", defaultJudgeModel),
+		LintDisabledRules: os.Getenv("LINT_DISABLED_RULES"),
+		TokenizerDir:      envString("TOKENIZER_DIR", defaultTokenizerDir),
+		TokenizerModel:    envString("TOKENIZER_MODEL", defaultTokenizerModel),
+		RedactionKey:      os.Getenv("REDACTION_KEY"),
+		RedactionPatterns: os.Getenv("REDACTION_PATTERNS"),
+		RedactionDisabled: redactionDisabled,
+		TracingExporter:   os.Getenv("TRACING_EXPORTER"),
+		OTLPEndpoint:      os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		ServiceName:       envString("OTEL_SERVICE_NAME", defaultServiceName),
 	}
 
 	return &config, nil
@@ -62,10 +165,66 @@ func prodHandler() {
 }
 
 func baseHandler(config *app.Config) {
+	if _, err := lint.New(lint.ParseRuleList(config.LintDisabledRules)); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	patterns, err := redact.ParsePatterns(config.RedactionPatterns)
+	if err == nil {
+		_, err = redact.New(patterns)
+	}
+	if err == nil && config.RedactionKey != "" {
+		_, err = redact.ParseKey(config.RedactionKey)
+	}
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// without a key the redacted values couldn't be restored for the owner
+	if config.RedactionDisabled {
+		slog.Warn("Redaction disabled, prompts are stored and sent to OpenAI as entered")
+	} else if config.RedactionKey == "" {
+		slog.Error("REDACTION_KEY not set, set REDACTION_DISABLED=true to run without redaction")
+		os.Exit(1)
+	}
+
+	switch config.TracingExporter {
+	case "":
+	case "stdout":
+		tracing.Configure(config.ServiceName, tracing.StdoutExporter{W: os.Stdout})
+	case "otlp":
+		if config.OTLPEndpoint == "" {
+			slog.Error("OTEL_EXPORTER_OTLP_ENDPOINT not set")
+			os.Exit(1)
+		}
+		tracing.Configure(config.ServiceName, tracing.OTLPExporter{Endpoint: config.OTLPEndpoint})
+	default:
+		slog.Error("Unknown tracing exporter", "exporter", config.TracingExporter)
+		os.Exit(1)
+	}
 
 	componentBuilder := app.ComponentBuilder{
 		Index:            component.Index,
 		App:              component.App,
+		Profile:          component.Profile,
+		History:          component.History,
+		ShareLink:        component.ShareLink,
+		Shared:           component.Shared,
+		Report:           component.Report,
+		Search:           component.Search,
+		EvaluationForm:   component.EvaluationForm,
+		Evaluation:       component.Evaluation,
+		AutoRunForm:      component.AutoRunForm,
+		AutoRun:          component.AutoRun,
+		Analyzers:        component.Analyzers,
+		SearchResults:    component.SearchResults,
+		Library:          component.Library,
+		LibraryPrompt:    component.LibraryPrompt,
+		LibraryForm:      component.LibraryForm,
+		BatchUpload:      component.BatchUpload,
+		BatchProgress:    component.BatchProgress,
 		Draft:            component.DraftModeEditor,
 		Edit:             component.EditModeEditor,
 		SuggestionWindow: component.SuggestionWindow,
@@ -80,6 +239,15 @@ func baseHandler(config *app.Config) {
 	optRepo := persistence.OptimizationRepo{BaseHeaders: dbHeader, BaseUrl: fmt.Sprintf("%s/optimization", config.DBUrl)}
 	suggRepo := persistence.SuggestionRepo{BaseHeaders: dbHeader, BaseUrl: fmt.Sprintf("%s/suggestion", config.DBUrl)}
 	runRepo := persistence.RunRepo{BaseHeaders: dbHeader, BaseUrl: fmt.Sprintf("%s/run", config.DBUrl)}
+	feedbRepo := persistence.FeedbackRepo{BaseHeaders: dbHeader, BaseUrl: fmt.Sprintf("%s/feedback_event", config.DBUrl)}
+	shareRepo := persistence.ShareRepo{BaseHeaders: dbHeader, BaseUrl: fmt.Sprintf("%s/share", config.DBUrl)}
+	evalRepo := persistence.EvaluationRepo{BaseHeaders: dbHeader, BaseUrl: fmt.Sprintf("%s/evaluation", config.DBUrl)}
+	evalCaseRepo := persistence.EvaluationCaseRepo{BaseHeaders: dbHeader, BaseUrl: fmt.Sprintf("%s/evaluation_case", config.DBUrl)}
+	autoRunRepo := persistence.AutoRunRepo{BaseHeaders: dbHeader, BaseUrl: fmt.Sprintf("%s/auto_run", config.DBUrl)}
+	analyzerRepo := persistence.CustomAnalyzerRepo{BaseHeaders: dbHeader, BaseUrl: fmt.Sprintf("%s/custom_analyzer", config.DBUrl)}
+	libRepo := persistence.LibraryRepo{BaseHeaders: dbHeader, BaseUrl: fmt.Sprintf("%s/library_prompt", config.DBUrl)}
+	batchRepo := persistence.BatchRepo{BaseHeaders: dbHeader, BaseUrl: fmt.Sprintf("%s/batch", config.DBUrl)}
+	profRepo := persistence.ProfileRepo{BaseHeaders: dbHeader, BaseUrl: fmt.Sprintf("%s/preference_profile", config.DBUrl)}
 
 	oaiRepo := persistence.OAIRepo{BaseHeaders: []string{
 		"Content-Type:application/json",
@@ -88,11 +256,20 @@ func baseHandler(config *app.Config) {
 	phRepo := persistence.PHRepo{BaseHeaders: []string{"Content-Type: application/json"}, ApiKey: config.PHApiKey}
 
 	repo := app.Repo{
-		OpRepo:   optRepo,
-		RunRepo:  runRepo,
-		SuggRepo: suggRepo,
-		OAIRepo:  oaiRepo,
-		PHRepo:   phRepo,
+		OpRepo:       optRepo,
+		RunRepo:      runRepo,
+		SuggRepo:     suggRepo,
+		FeedbRepo:    feedbRepo,
+		ProfRepo:     profRepo,
+		ShareRepo:    shareRepo,
+		BatchRepo:    batchRepo,
+		LibRepo:      libRepo,
+		EvalRepo:     evalRepo,
+		EvalCaseRepo: evalCaseRepo,
+		AutoRunRepo:  autoRunRepo,
+		AnalyzerRepo: analyzerRepo,
+		OAIRepo:      oaiRepo,
+		PHRepo:       phRepo,
 	}
 
 	a := app.App{
@@ -102,6 +279,22 @@ func baseHandler(config *app.Config) {
 	}
 
 	a.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := tracing.Shutdown(ctx); err != nil {
+		slog.Error("Exporting remaining spans failed", "error", err)
+	}
+}
+
+// logHandler writes JSON records in prod, so they can be queried by attribute, and text otherwise
+func logHandler(env string) slog.Handler {
+	if env == "prod" {
+		return slog.NewJSONHandler(os.Stderr, nil)
+	}
+
+	return slog.NewTextHandler(os.Stderr, nil)
 }
 
 func main() {
@@ -110,6 +303,8 @@ func main() {
 		env = "dev"
 	}
 
+	slog.SetDefault(slog.New(logHandler(env)))
+
 	switch env {
 	case "dev":
 		devHandler()
@@ -11,5 +11,7 @@ else
     exit 1
 fi
 
+./scripts/tokenizers.sh
+
 go build -o ./tmp/main .
 echo "Built go binary"
@@ -0,0 +1,12 @@
+#!/bin/bash
+# Downloads the tiktoken rank files token counts are read from
+
+dir=${TOKENIZER_DIR:-./static/tokenizer}
+mkdir -p "$dir"
+
+for encoding in cl100k_base o200k_base; do
+    if [ ! -f "$dir/$encoding.tiktoken" ]; then
+        curl -sSf -o "$dir/$encoding.tiktoken" "https://openaipublic.blob.core.windows.net/encodings/$encoding.tiktoken" || exit 1
+        echo "Downloaded $encoding encoding"
+    fi
+done